@@ -1,30 +1,89 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"maps"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 )
 
 /******************************************************************************/
+// FileExistsCondition waits for FileName to exist, or when FileName is a
+// glob for at least AtLeast (default 1) files to match it.
 type FileExistsCondition struct {
 	FileName string
+	AtLeast  int
 	Exists   bool
+	Matches  []string
+	Queue    *WatchQueue
+}
+
+func (self FileExistsCondition) WaitingOn() WaitableThing {
+	return WaitOnFileExists
+}
+
+func (self FileExistsCondition) Target() string {
+	return self.FileName
 }
 
 func (self FileExistsCondition) Init(ctx *Context) (Condition, error) {
 	return self, nil
 }
 
+func (self FileExistsCondition) Details() map[string]string {
+	if !IsGlob(self.FileName) {
+		return nil
+	}
+
+	return GlobDetails(self.Matches)
+}
+
+func (self FileExistsCondition) PollPolicy() PollPolicy {
+	return GlobPollPolicy(self.FileName)
+}
+
+func (self FileExistsCondition) Watch(ctx *Context, watch *FileWatch) (Condition, error) {
+	dir, err := WatchDirFor(self.FileName)
+	if err != nil {
+		return self, err
+	}
+
+	self.Queue, err = watch.WatchPaths(dir)
+	return self, err
+}
+
 func (self FileExistsCondition) Check(ctx *Context) (Condition, bool, error) {
 	if self.Exists {
 		return self, self.Exists, nil
 	}
 
+	if IsGlob(self.FileName) {
+		return self.checkGlob()
+	}
+
+	// NB: the file may have been created and removed again between checks
+	if self.Queue != nil && Saw(self.Queue.Drain(), self.FileName, WatchCreated|WatchModified) {
+		condition := FileExistsCondition{FileName: self.FileName, Exists: true}
+		return condition, condition.Exists, nil
+	}
+
 	_, err := os.Stat(self.FileName)
 	if err != nil && errors.Is(err, os.ErrNotExist) {
 		return self, false, nil
@@ -38,435 +97,2086 @@ func (self FileExistsCondition) Check(ctx *Context) (Condition, bool, error) {
 	return condition, condition.Exists, nil
 }
 
+func (self FileExistsCondition) checkGlob() (Condition, bool, error) {
+	// NB: the events only wake us up, the pattern is matched either way
+	if self.Queue != nil {
+		self.Queue.Drain()
+	}
+
+	matches, err := GlobFiles(self.FileName)
+	if err != nil {
+		return self, false, err
+	}
+
+	self.Matches = matches
+	self.Exists = len(matches) >= max(self.AtLeast, 1)
+	return self, self.Exists, nil
+}
+
 /******************************************************************************/
+// FileRemovedCondition waits for FileName to be removed, or when FileName
+// is a glob for no more than AtMost (default 0) files to match it.
 type FileRemovedCondition struct {
 	FileName string
+	AtMost   int
 	Removed  bool
+	Matches  []string
+	Queue    *WatchQueue
+}
+
+func (self FileRemovedCondition) WaitingOn() WaitableThing {
+	return WaitOnFileRemoved
+}
+
+func (self FileRemovedCondition) Target() string {
+	return self.FileName
 }
 
 func (self FileRemovedCondition) Init(ctx *Context) (Condition, error) {
 	return self, nil
 }
 
+func (self FileRemovedCondition) Details() map[string]string {
+	if !IsGlob(self.FileName) {
+		return nil
+	}
+
+	return GlobDetails(self.Matches)
+}
+
+func (self FileRemovedCondition) PollPolicy() PollPolicy {
+	return GlobPollPolicy(self.FileName)
+}
+
+func (self FileRemovedCondition) Watch(ctx *Context, watch *FileWatch) (Condition, error) {
+	dir, err := WatchDirFor(self.FileName)
+	if err != nil {
+		return self, err
+	}
+
+	self.Queue, err = watch.WatchPaths(dir)
+	return self, err
+}
+
 func (self FileRemovedCondition) Check(ctx *Context) (Condition, bool, error) {
 	if self.Removed {
 		return self, self.Removed, nil
 	}
 
+	if IsGlob(self.FileName) {
+		return self.checkGlob()
+	}
+
+	if self.Queue != nil && Saw(self.Queue.Drain(), self.FileName, WatchRemoved) {
+		condition := FileRemovedCondition{FileName: self.FileName, Removed: true}
+		return condition, condition.Removed, nil
+	}
+
 	_, err := os.Stat(self.FileName)
 	if err != nil && errors.Is(err, os.ErrNotExist) {
 		condition := FileRemovedCondition{FileName: self.FileName, Removed: true}
 		return condition, condition.Removed, nil
 	}
 
-	return self, false, err
+	return self, false, err
+}
+
+func (self FileRemovedCondition) checkGlob() (Condition, bool, error) {
+	if self.Queue != nil {
+		self.Queue.Drain()
+	}
+
+	matches, err := GlobFiles(self.FileName)
+	if err != nil {
+		return self, false, err
+	}
+
+	self.Matches = matches
+	self.Removed = len(matches) <= self.AtMost
+	return self, self.Removed, nil
+}
+
+/******************************************************************************/
+// DetectMode is which of a file's properties FileUpdatedCondition compares
+// to decide that it changed, any of them changing is enough.
+type DetectMode uint8
+
+const (
+	DetectMtime DetectMode = 1 << iota
+	DetectSize
+	DetectHash
+)
+
+// NB: in the order they're reported in
+var DetectModes = []DetectMode{DetectMtime, DetectSize, DetectHash}
+
+var DetectModeToStringTable = map[DetectMode]string{
+	DetectMtime: "mtime",
+	DetectSize:  "size",
+	DetectHash:  "hash",
+}
+
+var StringToDetectModeTable = map[string]DetectMode{
+	"mtime": DetectMtime,
+	"size":  DetectSize,
+	"hash":  DetectHash,
+}
+
+// ParseDetectMode parses eg: []string{"size", "hash"}, no names means mtime.
+func ParseDetectMode(names []string) (DetectMode, error) {
+	var mode DetectMode
+	for _, name := range names {
+		detect, ok := StringToDetectModeTable[name]
+		if !ok {
+			return 0, fmt.Errorf("unrecognized detect mode '%s', expected mtime, size or hash", name)
+		}
+
+		mode |= detect
+	}
+
+	if mode == 0 {
+		mode = DetectMtime
+	}
+
+	return mode, nil
+}
+
+func (self DetectMode) String() string {
+	var names []string
+	for _, detect := range DetectModes {
+		if self&detect != 0 {
+			names = append(names, DetectModeToStringTable[detect])
+		}
+	}
+
+	return strings.Join(names, ",")
+}
+
+type FileUpdatedCondition struct {
+	FileName string
+	// the zero value is DetectMtime
+	Detect    DetectMode
+	FileInfo  *fs.FileInfo
+	Sum       string
+	ChangedBy DetectMode
+	Changed   bool
+	Queue     *WatchQueue
+}
+
+func (self FileUpdatedCondition) WaitingOn() WaitableThing {
+	return WaitOnFileChanged
+}
+
+func (self FileUpdatedCondition) Target() string {
+	return self.FileName
+}
+
+func (self FileUpdatedCondition) detect() DetectMode {
+	if self.Detect == 0 {
+		return DetectMtime
+	}
+
+	return self.Detect
+}
+
+func (self FileUpdatedCondition) Init(ctx *Context) (Condition, error) {
+	fileInfo, err := os.Stat(self.FileName)
+	if err != nil {
+		return self, err
+	}
+
+	self.FileInfo = &fileInfo
+	if self.detect()&DetectHash != 0 {
+		self.Sum, err = HashFile(self.FileName)
+		if err != nil {
+			return self, err
+		}
+	}
+
+	return self, nil
+}
+
+// NB: hashing reads the whole file, don't do it every 100ms
+func (self FileUpdatedCondition) PollPolicy() PollPolicy {
+	if self.detect()&DetectHash == 0 {
+		return PollPolicy{}
+	}
+
+	return PollPolicy{Interval: time.Second, MaxInterval: time.Second, BackoffFactor: 1.0}
+}
+
+func (self FileUpdatedCondition) Details() map[string]string {
+	if self.FileInfo == nil {
+		return nil
+	}
+
+	details := map[string]string{
+		"detect":     self.detect().String(),
+		"changed_by": self.ChangedBy.String(),
+		"size":       strconv.FormatInt((*self.FileInfo).Size(), 10),
+		"mtime":      (*self.FileInfo).ModTime().Format(time.RFC3339Nano),
+	}
+
+	if self.Sum != "" {
+		details["sha256"] = self.Sum
+	}
+
+	return details
+}
+
+func (self FileUpdatedCondition) Watch(ctx *Context, watch *FileWatch) (Condition, error) {
+	var err error
+	// NB: the directory is watched too, to see the file being replaced
+	self.Queue, err = watch.WatchPaths(self.FileName, filepath.Dir(self.FileName))
+	return self, err
+}
+
+func (self FileUpdatedCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Changed {
+		return self, self.Changed, nil
+	}
+
+	// NB: events only wake us up to compare now, a chmod or a close
+	// without writing is an event too
+	if self.Queue != nil {
+		self.Queue.Drain()
+	}
+
+	fileInfo, err := os.Stat(self.FileName)
+	if err != nil {
+		return self, false, err
+	}
+
+	detect := self.detect()
+	var changedBy DetectMode
+	if detect&DetectMtime != 0 && !(*self.FileInfo).ModTime().Equal(fileInfo.ModTime()) {
+		changedBy |= DetectMtime
+	}
+
+	if detect&DetectSize != 0 && (*self.FileInfo).Size() != fileInfo.Size() {
+		changedBy |= DetectSize
+	}
+
+	sum := self.Sum
+	if detect&DetectHash != 0 {
+		sum, err = HashFile(self.FileName)
+		if err != nil {
+			return self, false, err
+		}
+
+		if sum != self.Sum {
+			changedBy |= DetectHash
+		}
+	}
+
+	if ctx.Verbose {
+		fmt.Printf("FileUpdatedCondition: detect=%s changed_by=%s size=%d mtime=%v\n", detect, changedBy, fileInfo.Size(), fileInfo.ModTime())
+	}
+
+	if changedBy != 0 {
+		self.FileInfo = &fileInfo
+		self.Sum = sum
+		self.ChangedBy = changedBy
+		self.Changed = true
+	}
+
+	return self, self.Changed, nil
+}
+
+/******************************************************************************/
+// FileContainsCondition follows FileName like tail -F, across rotation
+// and truncation, until Count lines have matched Pattern. A line that
+// matches ErrorPattern fails the wait straight away.
+type FileContainsCondition struct {
+	FileName     string
+	Pattern      string
+	ErrorPattern string
+	FromStart    bool
+	Count        int
+	Regexp       *regexp.Regexp
+	ErrorRegexp  *regexp.Regexp
+	File         *os.File
+	Offset       int64
+	Partial      []byte
+	Matches      int
+	MatchedLine  string
+	Found        bool
+	Queue        *WatchQueue
+}
+
+// NewFileContainsCondition compiles the patterns up front, so that a bad
+// one is reported as a bad argument.
+func NewFileContainsCondition(fileName, pattern, errorPattern string, fromStart bool, count int) (FileContainsCondition, error) {
+	var err error
+	condition := FileContainsCondition{FileName: fileName, Pattern: pattern, ErrorPattern: errorPattern, FromStart: fromStart, Count: count}
+	condition.Regexp, err = regexp.Compile(pattern)
+	if err != nil {
+		return condition, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	if errorPattern != "" {
+		condition.ErrorRegexp, err = regexp.Compile(errorPattern)
+		if err != nil {
+			return condition, fmt.Errorf("invalid error pattern: %w", err)
+		}
+	}
+
+	return condition, nil
+}
+
+func (self FileContainsCondition) WaitingOn() WaitableThing {
+	return WaitOnFileContains
+}
+
+func (self FileContainsCondition) Target() string {
+	return self.FileName
+}
+
+func (self FileContainsCondition) Details() map[string]string {
+	details := map[string]string{"matches": strconv.Itoa(self.Matches)}
+	if self.MatchedLine != "" {
+		details["matched_line"] = self.MatchedLine
+	}
+
+	return details
+}
+
+func (self FileContainsCondition) Init(ctx *Context) (Condition, error) {
+	var err error
+	if self.Count <= 0 {
+		self.Count = 1
+	}
+
+	if self.Regexp == nil {
+		self.Regexp, err = regexp.Compile(self.Pattern)
+		if err != nil {
+			return self, err
+		}
+	}
+
+	if self.ErrorRegexp == nil && self.ErrorPattern != "" {
+		self.ErrorRegexp, err = regexp.Compile(self.ErrorPattern)
+		if err != nil {
+			return self, err
+		}
+	}
+
+	// NB: a file that doesn't exist yet is read from the start once it
+	// has been created
+	file, err := os.Open(self.FileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return self, nil
+	}
+
+	if err != nil {
+		return self, err
+	}
+
+	self.File = file
+	if !self.FromStart {
+		self.Offset, err = file.Seek(0, io.SeekEnd)
+	}
+
+	return self, err
+}
+
+func (self FileContainsCondition) Watch(ctx *Context, watch *FileWatch) (Condition, error) {
+	var err error
+	// NB: watching the directory sees writes to the file, as well as it
+	// being created, rotated or removed
+	self.Queue, err = watch.WatchPaths(filepath.Dir(self.FileName))
+	return self, err
+}
+
+func (self FileContainsCondition) Close() error {
+	if self.File == nil {
+		return nil
+	}
+
+	return self.File.Close()
+}
+
+func (self FileContainsCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Found {
+		return self, self.Found, nil
+	}
+
+	// NB: the events only wake us up, the file is read either way
+	if self.Queue != nil {
+		self.Queue.Drain()
+	}
+
+	// NB: like tail -F, the rest of a rotated file is read before moving
+	// on to the new one
+	self, err := self.readLines()
+	if err != nil || self.Found {
+		return self, self.Found, err
+	}
+
+	self, reopened, err := self.follow()
+	if err != nil || !reopened {
+		return self, false, err
+	}
+
+	if ctx.Verbose {
+		fmt.Printf("FileContainsCondition: %s was rotated or truncated, reading from the start\n", self.FileName)
+	}
+
+	self, err = self.readLines()
+	return self, self.Found, err
+}
+
+// follow checks whether FileName is now a different file (it was
+// rotated) or is shorter than what's been read (it was truncated), both
+// are read from the start.
+func (self FileContainsCondition) follow() (FileContainsCondition, bool, error) {
+	fileInfo, err := os.Stat(self.FileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return self, false, nil
+	}
+
+	if err != nil {
+		return self, false, err
+	}
+
+	if self.File != nil {
+		current, err := self.File.Stat()
+		if err == nil && os.SameFile(fileInfo, current) {
+			if fileInfo.Size() >= self.Offset {
+				return self, false, nil
+			}
+
+			self.Offset, self.Partial = 0, nil
+			_, err = self.File.Seek(0, io.SeekStart)
+			return self, true, err
+		}
+
+		self.File.Close()
+		self.File = nil
+	}
+
+	file, err := os.Open(self.FileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return self, false, nil
+	}
+
+	if err != nil {
+		return self, false, err
+	}
+
+	self.File, self.Offset, self.Partial = file, 0, nil
+	return self, true, nil
+}
+
+// readLines matches each complete line written since the last read.
+func (self FileContainsCondition) readLines() (FileContainsCondition, error) {
+	if self.File == nil {
+		return self, nil
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := self.File.Read(buf)
+		self.Offset += int64(n)
+		self.Partial = append(self.Partial, buf[:n]...)
+
+		for {
+			idx := bytes.IndexByte(self.Partial, '\n')
+			if idx < 0 && len(self.Partial) <= MaxTailLineBytes {
+				break
+			}
+
+			// NB: a line this long without a newline is matched as is
+			if idx < 0 {
+				idx = len(self.Partial)
+			}
+
+			line := strings.TrimSuffix(string(self.Partial[:idx]), "\r")
+			self.Partial = self.Partial[min(idx+1, len(self.Partial)):]
+
+			if self.ErrorRegexp != nil && self.ErrorRegexp.MatchString(line) {
+				self.MatchedLine = line
+				return self, fmt.Errorf("%s: a line matched the error pattern '%s': %s", self.FileName, self.ErrorPattern, line)
+			}
+
+			if self.Regexp.MatchString(line) {
+				self.Matches++
+				if self.Matches >= self.Count {
+					self.MatchedLine = line
+					self.Found = true
+					return self, nil
+				}
+			}
+		}
+
+		if readErr == io.EOF || (n == 0 && readErr == nil) {
+			return self, nil
+		}
+
+		if readErr != nil {
+			return self, readErr
+		}
+	}
+}
+
+/******************************************************************************/
+// FileStableCondition waits for FileName to stop changing: its size,
+// mtime (and with Hash its contents) have to stay the same for QuietFor.
+type FileStableCondition struct {
+	FileName  string
+	QuietFor  time.Duration
+	Hash      bool
+	MinSize   int64
+	Exists    bool
+	Size      int64
+	ModTime   time.Time
+	Sum       string
+	ChangedAt time.Time
+	Stable    bool
+}
+
+func (self FileStableCondition) WaitingOn() WaitableThing {
+	return WaitOnFileStable
+}
+
+func (self FileStableCondition) Target() string {
+	return self.FileName
+}
+
+func (self FileStableCondition) Details() map[string]string {
+	details := map[string]string{
+		"size":      strconv.FormatInt(self.Size, 10),
+		"mtime":     self.ModTime.Format(time.RFC3339Nano),
+		"quiet_for": time.Since(self.ChangedAt).Round(time.Millisecond).String(),
+	}
+
+	if self.Sum != "" {
+		details["sha256"] = self.Sum
+	}
+
+	return details
+}
+
+func (self FileStableCondition) Init(ctx *Context) (Condition, error) {
+	return self, nil
+}
+
+// NB: checks have to happen often enough to notice the quiet period is
+// over, a stat is cheap
+func (self FileStableCondition) PollPolicy() PollPolicy {
+	interval := min(max(self.QuietFor/10, 100*time.Millisecond), time.Second)
+	return PollPolicy{Interval: interval, MaxInterval: interval, BackoffFactor: 1.0}
+}
+
+func (self FileStableCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Stable {
+		return self, self.Stable, nil
+	}
+
+	fileInfo, err := os.Stat(self.FileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		self.Exists = false
+		return self, false, nil
+	}
+
+	if err != nil {
+		return self, false, err
+	}
+
+	sum := ""
+	if self.Hash {
+		sum, err = HashFile(self.FileName)
+		if err != nil {
+			return self, false, err
+		}
+	}
+
+	changed := !self.Exists || fileInfo.Size() != self.Size || !fileInfo.ModTime().Equal(self.ModTime) || sum != self.Sum
+	if changed {
+		if ctx.Verbose {
+			fmt.Printf("FileStableCondition: %s changed size=%d mtime=%s\n", self.FileName, fileInfo.Size(), fileInfo.ModTime())
+		}
+
+		self.Exists, self.Size, self.ModTime, self.Sum = true, fileInfo.Size(), fileInfo.ModTime(), sum
+		self.ChangedAt = time.Now()
+		return self, false, nil
+	}
+
+	if self.Size < self.MinSize || time.Since(self.ChangedAt) < self.QuietFor {
+		return self, false, nil
+	}
+
+	self.Stable = true
+	return self, self.Stable, nil
+}
+
+// HashFile returns the hex sha256 of path's contents, the file is read
+// incrementally so large files aren't read in to memory.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+/******************************************************************************/
+type DirExistsCondition struct {
+	DirName string
+	Exists  bool
+	Queue   *WatchQueue
+}
+
+func (self DirExistsCondition) WaitingOn() WaitableThing {
+	return WaitOnDirExists
+}
+
+func (self DirExistsCondition) Target() string {
+	return self.DirName
+}
+
+func (self DirExistsCondition) Init(ctx *Context) (Condition, error) {
+	return self, nil
+}
+
+func (self DirExistsCondition) Watch(ctx *Context, watch *FileWatch) (Condition, error) {
+	var err error
+	self.Queue, err = watch.WatchPaths(filepath.Dir(self.DirName))
+	return self, err
+}
+
+func (self DirExistsCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Exists {
+		return self, self.Exists, nil
+	}
+
+	if self.Queue != nil {
+		for _, event := range self.Queue.Drain() {
+			if event.IsDir && event.Op&WatchCreated != 0 && event.Path == filepath.Clean(self.DirName) {
+				condition := DirExistsCondition{DirName: self.DirName, Exists: true}
+				return condition, condition.Exists, nil
+			}
+		}
+	}
+
+	fileInfo, err := os.Stat(self.DirName)
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		return self, false, nil
+	}
+
+	if err != nil {
+		return self, false, err
+	}
+
+	// NB: has to be a directory
+	if !fileInfo.Mode().IsDir() {
+		return self, self.Exists, nil
+	}
+
+	condition := DirExistsCondition{DirName: self.DirName, Exists: true}
+	return condition, condition.Exists, nil
+}
+
+/******************************************************************************/
+type DirRemovedCondition struct {
+	DirName string
+	Removed bool
+	Queue   *WatchQueue
+}
+
+func (self DirRemovedCondition) WaitingOn() WaitableThing {
+	return WaitOnDirRemoved
+}
+
+func (self DirRemovedCondition) Target() string {
+	return self.DirName
+}
+
+func (self DirRemovedCondition) Init(ctx *Context) (Condition, error) {
+	return self, nil
+}
+
+func (self DirRemovedCondition) Watch(ctx *Context, watch *FileWatch) (Condition, error) {
+	var err error
+	self.Queue, err = watch.WatchPaths(filepath.Dir(self.DirName))
+	return self, err
+}
+
+func (self DirRemovedCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Removed {
+		return self, self.Removed, nil
+	}
+
+	if self.Queue != nil && Saw(self.Queue.Drain(), self.DirName, WatchRemoved) {
+		return DirRemovedCondition{DirName: self.DirName, Removed: true}, true, nil
+	}
+
+	_, err := os.Stat(self.DirName)
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		return DirRemovedCondition{DirName: self.DirName, Removed: true}, true, nil
+	}
+
+	if err != nil {
+		return self, false, err
+	}
+
+	// it exists
+	return self, false, nil
+}
+
+/******************************************************************************/
+type DirUpdatedCondition struct {
+	DirName   string
+	Recursive bool
+	Include   []string
+	Exclude   []string
+	FileInfo  *fs.FileInfo
+	Tree      *DirTree
+	Watcher   *FileWatch
+	Changes   DirChanges
+	Changed   bool
+	Queue     *WatchQueue
+}
+
+func (self DirUpdatedCondition) WaitingOn() WaitableThing {
+	return WaitOnDirChanged
+}
+
+func (self DirUpdatedCondition) Target() string {
+	return self.DirName
+}
+
+func (self DirUpdatedCondition) Init(ctx *Context) (Condition, error) {
+	fileInfo, err := os.Stat(self.DirName)
+	if err != nil {
+		return self, err
+	}
+
+	self.FileInfo = &fileInfo
+	if self.Recursive {
+		self.Tree, err = NewDirTree(self.DirName, self.Include, self.Exclude)
+		if err != nil {
+			return self, err
+		}
+	}
+
+	return self, nil
+}
+
+// NB: a full rescan of a large tree is expensive, without a watch to say
+// which directories changed don't do it too often
+func (self DirUpdatedCondition) PollPolicy() PollPolicy {
+	if !self.Recursive {
+		return PollPolicy{}
+	}
+
+	return PollPolicy{Interval: 2 * time.Second, MaxInterval: 10 * time.Second, BackoffFactor: 1.5}
+}
+
+func (self DirUpdatedCondition) Details() map[string]string {
+	if !self.Recursive {
+		return nil
+	}
+
+	return self.Changes.Details()
+}
+
+func (self DirUpdatedCondition) Watch(ctx *Context, watch *FileWatch) (Condition, error) {
+	if !self.Recursive {
+		var err error
+		self.Queue, err = watch.WatchPaths(self.DirName)
+		return self, err
+	}
+
+	queue := watch.NewQueue()
+	for _, dir := range self.Tree.DirNames() {
+		err := watch.Add(filepath.Join(self.Tree.Root, dir))
+		if err != nil {
+			// NB: eg: out of inotify watches, fall back to full rescans
+			return self, err
+		}
+	}
+
+	self.Queue = queue
+	self.Watcher = watch
+	return self, nil
+}
+
+// dirtyDirs are the directories of the tree that the watch saw changes
+// in, or all of them when there is no watch.
+func (self DirUpdatedCondition) dirtyDirs() []string {
+	if self.Queue == nil {
+		return self.Tree.DirNames()
+	}
+
+	var dirs []string
+	for _, event := range self.Queue.Drain() {
+		if event.Op&WatchOverflow != 0 {
+			return self.Tree.DirNames()
+		}
+
+		rel, err := filepath.Rel(self.Tree.Root, event.Path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		// NB: the entry's parent lists it, a directory also lists its own
+		// entries
+		dirs = append(dirs, filepath.Dir(rel), rel)
+	}
+
+	return dirs
+}
+
+func (self DirUpdatedCondition) checkTree(ctx *Context) (Condition, bool, error) {
+	changes, err := self.Tree.Rescan(self.dirtyDirs())
+	if err != nil {
+		return self, false, err
+	}
+
+	if self.Watcher != nil {
+		for _, dir := range changes.newDirs {
+			err := self.Watcher.Add(filepath.Join(self.Tree.Root, dir))
+			if err != nil {
+				// NB: the new dir can't be watched, fall back to rescanning
+				// everything
+				if ctx.Verbose {
+					fmt.Printf("DirUpdatedCondition: failed to watch %s, polling instead; err=%v\n", dir, err)
+				}
+
+				self.Queue = nil
+				self.Watcher = nil
+				break
+			}
+		}
+	}
+
+	if ctx.Verbose {
+		fmt.Printf("DirUpdatedCondition: %d change(s) under %s\n", changes.Count(), self.DirName)
+	}
+
+	if changes.Count() == 0 {
+		return self, false, nil
+	}
+
+	self.Changes = changes
+	self.Changed = true
+	return self, self.Changed, nil
+}
+
+func (self DirUpdatedCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Changed {
+		return self, self.Changed, nil
+	}
+
+	if self.Recursive {
+		return self.checkTree(ctx)
+	}
+
+	// NB: like the directory's mtime, entries being added or removed are a
+	// change (even one that's too quick for the mtime to show), writes to
+	// the entries themselves are not; any other event, eg: a chmod of the
+	// directory, only wakes us up to compare the mtime
+	entriesChanged := false
+	if self.Queue != nil {
+		dirName := filepath.Clean(self.DirName)
+		for _, event := range self.Queue.Drain() {
+			if event.Path != dirName && event.Op&(WatchCreated|WatchRemoved) != 0 {
+				entriesChanged = true
+			}
+		}
+	}
+
+	fileInfo, err := os.Stat(self.DirName)
+	if err != nil {
+		return self, false, err
+	}
+
+	if ctx.Verbose {
+		fmt.Printf("DirUpdatedCondition: prev:%v curr:%v entries_changed=%v\n", (*self.FileInfo).ModTime(), fileInfo.ModTime(), entriesChanged)
+	}
+
+	if entriesChanged || !(*self.FileInfo).ModTime().Equal(fileInfo.ModTime()) {
+		condition := DirUpdatedCondition{DirName: self.DirName, FileInfo: &fileInfo, Changed: true}
+		return condition, condition.Changed, nil
+	}
+
+	return self, false, nil
+}
+
+/******************************************************************************/
+// PidExitedCondition waits for Pid to exit, and with Tree for all of its
+// descendants to have exited too.
+type PidExitedCondition struct {
+	Pid         int
+	Expect      *ExitExpectation
+	Tree        bool
+	StartTime   uint64
+	Watch       *PidWatch
+	Descendants *ProcTree
+	PidExited   bool
+	Exited      bool
+	Status      *ExitStatus
+}
+
+func (self PidExitedCondition) WaitingOn() WaitableThing {
+	return WaitOnPidExit
+}
+
+func (self PidExitedCondition) Target() string {
+	return strconv.Itoa(self.Pid)
+}
+
+func (self PidExitedCondition) Details() map[string]string {
+	unknown := self.Exited && self.Status == nil && self.Expect != nil
+	if self.Status == nil && self.Descendants == nil && !unknown {
+		return nil
+	}
+
+	details := map[string]string{}
+	if self.Status != nil {
+		details = self.Status.Details()
+	}
+
+	// NB: --expect-exit and --expect-signal can't be checked, say so rather
+	// than leave it looking like they were met
+	if unknown {
+		details["exit_status"] = "unknown"
+	}
+
+	if self.Descendants != nil {
+		details["descendants"] = strconv.Itoa(self.Descendants.Seen)
+	}
+
+	return details
+}
+
+// NB: descendants are found by scanning /proc, it has to happen often
+// enough to see short lived ones
+func (self PidExitedCondition) PollPolicy() PollPolicy {
+	if !self.Tree {
+		return PollPolicy{}
+	}
+
+	return PollPolicy{Interval: 250 * time.Millisecond, MaxInterval: 250 * time.Millisecond, BackoffFactor: 1.0}
+}
+
+func (self PidExitedCondition) Unexpected() error {
+	return self.Expect.Check(Describe(self), self.Status)
+}
+
+func (self PidExitedCondition) Init(ctx *Context) (Condition, error) {
+	var err error
+	self.Watch, err = NewPidWatch(self.Pid)
+	if err != nil && ctx.Verbose {
+		fmt.Printf("PidExitedCondition: polling, unable to watch pid=%d; err=%v\n", self.Pid, err)
+	}
+
+	// NB: remember when the process started so that a new process that
+	// reuses the pid isn't mistaken for the one we're waiting on; it's
+	// read after the pidfd is opened, so that the pidfd can't be of a
+	// process that reused the pid since
+	startTime, err := PidStartTime(self.Pid)
+	if err == nil {
+		self.StartTime = startTime
+	}
+
+	if self.Tree {
+		self.Descendants = NewProcTree(self.Pid, false)
+		err = self.Descendants.Scan(true)
+		if err != nil {
+			return self, err
+		}
+	}
+
+	return self, nil
+}
+
+func (self PidExitedCondition) WakeOn() []<-chan struct{} {
+	if self.Watch == nil {
+		return nil
+	}
+
+	return []<-chan struct{}{self.Watch.Wake()}
+}
+
+func (self PidExitedCondition) Close() error {
+	if self.Watch == nil {
+		return nil
+	}
+
+	return self.Watch.Close()
+}
+
+// pidExited reports whether Pid itself has exited, and how when that
+// can be found out.
+func (self PidExitedCondition) pidExited() (bool, *ExitStatus, error) {
+	// NB: an open pidfd always refers to our process, even if the pid has
+	// since been reused
+	if self.Watch != nil && !self.Watch.Exited() {
+		return false, nil, nil
+	}
+
+	alive, status, err := PidState(self.Pid, self.StartTime)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if alive && self.Watch == nil {
+		return false, nil, nil
+	}
+
+	// NB: the pidfd said it exited, the pid may just not be reaped yet
+	return true, status, nil
+}
+
+func (self PidExitedCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Exited {
+		return self, self.Exited, nil
+	}
+
+	if !self.PidExited {
+		exited, status, err := self.pidExited()
+		if err != nil {
+			return self, false, err
+		}
+
+		self.PidExited = exited
+		self.Status = status
+	}
+
+	if self.Descendants != nil {
+		err := self.Descendants.Scan(!self.PidExited)
+		if err != nil {
+			return self, false, err
+		}
+
+		if ctx.Verbose {
+			fmt.Printf("PidExitedCondition: pid exited=%v, %d descendant(s) running\n", self.PidExited, len(self.Descendants.Members))
+		}
+
+		if len(self.Descendants.Members) > 0 {
+			return self, false, nil
+		}
+	}
+
+	self.Exited = self.PidExited
+	return self, self.Exited, nil
+}
+
+/******************************************************************************/
+// ProcExitedCondition waits for the processes that matched when the wait
+// started to exit, all of them or (with Any) the first one. Processes that
+// start matching later aren't waited on.
+type ProcExitedCondition struct {
+	Matcher ProcMatcher
+	Any     bool
+	Procs   []ProcInfo
+	Gone    []ProcInfo
+	Exited  bool
+}
+
+func (self ProcExitedCondition) WaitingOn() WaitableThing {
+	return WaitOnProcExits
+}
+
+func (self ProcExitedCondition) Target() string {
+	return self.Matcher.String()
+}
+
+func (self ProcExitedCondition) Init(ctx *Context) (Condition, error) {
+	var err error
+	self.Procs, err = self.Matcher.MatchProcs()
+	if err != nil {
+		return self, err
+	}
+
+	// NB: nothing matching means there's nothing left to wait on, Check
+	// is met straight away with a matched_count of 0
+	if ctx.Verbose && len(self.Procs) == 0 {
+		fmt.Printf("ProcExitedCondition: no processes match %s\n", self.Matcher)
+	} else if ctx.Verbose {
+		fmt.Printf("ProcExitedCondition: waiting on pids=%v\n", ProcDetails(self.Procs)["pids"])
+	}
+
+	return self, nil
+}
+
+func (self ProcExitedCondition) Details() map[string]string {
+	details := ProcDetails(self.Gone)
+	details["matched_count"] = strconv.Itoa(len(self.Procs))
+	return details
+}
+
+func (self ProcExitedCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Exited {
+		return self, self.Exited, nil
+	}
+
+	var gone []ProcInfo
+	for _, proc := range self.Procs {
+		alive, _, err := PidState(proc.Pid, proc.StartTime)
+		if err != nil {
+			return self, false, err
+		}
+
+		if !alive {
+			gone = append(gone, proc)
+		}
+	}
+
+	self.Gone = gone
+	if self.Any && len(self.Procs) > 0 {
+		self.Exited = len(gone) > 0
+	} else {
+		self.Exited = len(gone) == len(self.Procs)
+	}
+
+	return self, self.Exited, nil
+}
+
+/******************************************************************************/
+// ProcStartedCondition waits for a process that matches to be running,
+// with NewOnly ones that were already running when the wait started
+// don't count.
+type ProcStartedCondition struct {
+	Matcher  ProcMatcher
+	NewOnly  bool
+	Existing map[int]ProcInfo
+	Procs    []ProcInfo
+	Started  bool
+}
+
+func (self ProcStartedCondition) WaitingOn() WaitableThing {
+	return WaitOnProcStarted
+}
+
+func (self ProcStartedCondition) Target() string {
+	return self.Matcher.String()
+}
+
+func (self ProcStartedCondition) Init(ctx *Context) (Condition, error) {
+	if !self.NewOnly {
+		return self, nil
+	}
+
+	procs, err := self.Matcher.MatchProcs()
+	if err != nil {
+		return self, err
+	}
+
+	self.Existing = map[int]ProcInfo{}
+	for _, proc := range procs {
+		self.Existing[proc.Pid] = proc
+	}
+
+	return self, nil
+}
+
+// NB: every check reads all of /proc
+func (self ProcStartedCondition) PollPolicy() PollPolicy {
+	return PollPolicy{Interval: 250 * time.Millisecond, MaxInterval: time.Second, BackoffFactor: 1.5}
+}
+
+func (self ProcStartedCondition) Details() map[string]string {
+	return ProcDetails(self.Procs)
+}
+
+func (self ProcStartedCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Started {
+		return self, self.Started, nil
+	}
+
+	procs, err := self.Matcher.MatchProcs()
+	if err != nil {
+		return self, false, err
+	}
+
+	var started []ProcInfo
+	for _, proc := range procs {
+		// NB: a new process may reuse the pid, and one that exec'd keeps
+		// its pid and start time
+		existing, existed := self.Existing[proc.Pid]
+		if !existed || existing.StartTime != proc.StartTime || existing.Cmdline != proc.Cmdline {
+			started = append(started, proc)
+		}
+	}
+
+	self.Procs = started
+	self.Started = len(started) > 0
+	return self, self.Started, nil
+}
+
+/******************************************************************************/
+// CommandExitedCondition runs CommandStr and waits for it to exit, and
+// with Tree for all of its descendants to have exited too.
+type CommandExitedCondition struct {
+	CommandStr  string
+	TailLines   int
+	Expect      *ExitExpectation
+	Tree        bool
+	Command     *exec.Cmd
+	Output      *TailBuffer
+	Descendants *ProcTree
+	StartTime   time.Time
+	Duration    time.Duration
+	Exited      bool
+	Finished    bool
+	Status      *ExitStatus
+	TailFile    string
+	Ctx         context.Context
+	ExitChan    chan error
+	Done        chan struct{}
+	// receives once, when the command exits
+	Wake chan struct{}
+}
+
+func (self CommandExitedCondition) WaitingOn() WaitableThing {
+	return WaitOnCommandExit
+}
+
+func (self CommandExitedCondition) Target() string {
+	return self.CommandStr
+}
+
+func (self CommandExitedCondition) Init(ctx *Context) (Condition, error) {
+	if self.TailLines <= 0 {
+		self.TailLines = DefaultTailLines
+	}
+
+	// NB: orphans of the command's descendants are reparented to us
+	// instead of init, so the tree can't lose them
+	subreaper := false
+	if self.Tree {
+		err := SetChildSubreaper()
+		subreaper = err == nil
+		if err != nil && ctx.Verbose {
+			fmt.Printf("CommandExitedCondition: unable to become a subreaper; err=%v\n", err)
+		}
+	}
+
+	// NB: output is still streamed to the terminal, the tail is kept so
+	// the last lines can be passed along to the notifications
+	self.Output = NewTailBuffer(self.TailLines)
+	cmd := exec.Command("bash", "-c", self.CommandStr)
+	SetProcessGroup(cmd)
+	cmd.Stdout = io.MultiWriter(os.Stdout, self.Output)
+	cmd.Stderr = io.MultiWriter(os.Stderr, self.Output)
+	// NB: don't wait forever on output from background processes the
+	// command left behind still holding on to its stdout or stderr,
+	// unless they're being waited on anyway (closing it would SIGPIPE
+	// them)
+	if !self.Tree {
+		cmd.WaitDelay = time.Second
+	}
+
+	self.StartTime = time.Now()
+	err := cmd.Start()
+
+	if err != nil {
+		return self, err
+	}
+
+	AddLaunched(cmd.Process.Pid)
+	self.Command = cmd
+	self.Ctx = ctx.Context()
+	self.ExitChan = make(chan error, 1)
+	self.Done = make(chan struct{})
+	self.Wake = make(chan struct{}, 1)
+	go func(exitChan chan error, done chan struct{}, wake chan struct{}) {
+		if ctx.Verbose {
+			fmt.Printf("CommandExitedCondition: START go func: calling cmd.Wait\n")
+		}
+		res := cmd.Wait()
+		RemoveLaunched(cmd.Process.Pid)
+		exitChan <- res
+		close(done)
+		wake <- struct{}{}
+		if ctx.Verbose {
+			fmt.Printf("CommandExitedCondition: EXIT  go func: called cmd.Wait res=%v\n", res)
+		}
+	}(self.ExitChan, self.Done, self.Wake)
+
+	go ForwardInterrupt(self.Ctx, cmd, self.Done)
+
+	if self.Tree {
+		self.Descendants = NewProcTree(cmd.Process.Pid, subreaper)
+	}
+
+	return self, nil
+}
+
+// NB: not Done, once it's closed it would wake the wait over and over
+// while the descendants are still running
+func (self CommandExitedCondition) WakeOn() []<-chan struct{} {
+	if self.Wake == nil {
+		return nil
+	}
+
+	return []<-chan struct{}{self.Wake}
+}
+
+// NB: descendants are found by scanning /proc, it has to happen often
+// enough to see short lived ones
+func (self CommandExitedCondition) PollPolicy() PollPolicy {
+	if !self.Tree {
+		return PollPolicy{}
+	}
+
+	return PollPolicy{Interval: 250 * time.Millisecond, MaxInterval: 250 * time.Millisecond, BackoffFactor: 1.0}
+}
+
+func (self CommandExitedCondition) Details() map[string]string {
+	if self.Status == nil {
+		return nil
+	}
+
+	details := self.Status.Details()
+	details["duration"] = self.Duration.Round(time.Millisecond).String()
+	details["duration_seconds"] = strconv.FormatFloat(self.Duration.Seconds(), 'f', 3, 64)
+	details["tail"] = strings.Join(self.Output.Tail(), "\n")
+	if self.TailFile != "" {
+		details["tail_file"] = self.TailFile
+	}
+
+	if self.Descendants != nil {
+		details["descendants"] = strconv.Itoa(self.Descendants.Seen)
+	}
+
+	return details
+}
+
+func (self CommandExitedCondition) Unexpected() error {
+	return self.Expect.Check(Describe(self), self.Status)
+}
+
+// Close stops the command if the wait ended before it did (a timeout or
+// an interrupt), and removes the tail file, which is only around for as
+// long as the notifications are being sent.
+func (self CommandExitedCondition) Close() error {
+	if self.Done != nil && !self.Finished {
+		self.Stop()
+	}
+
+	if self.TailFile == "" {
+		return nil
+	}
+
+	return os.Remove(self.TailFile)
+}
+
+// Stop signals the command's process group, it is killed if it hasn't
+// exited after KillGracePeriod.
+func (self CommandExitedCondition) Stop() {
+	// NB: ForwardInterrupt has already sent the signal we were interrupted by
+	if self.Ctx.Err() == nil {
+		_ = SignalProcessGroup(self.Command, syscall.SIGTERM)
+	}
+
+	select {
+	case <-self.Done:
+		// NB: bash starts background jobs ignoring SIGINT, they're
+		// stopped along with the command
+		_ = SignalProcessGroup(self.Command, syscall.SIGTERM)
+	case <-time.After(KillGracePeriod):
+		fmt.Fprintf(os.Stderr, "CommandExitedCondition: killing '%s', it didn't exit after %s\n", self.CommandStr, KillGracePeriod)
+		_ = SignalProcessGroup(self.Command, os.Kill)
+	}
+}
+
+func (self CommandExitedCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Finished {
+		return self, self.Finished, nil
+	}
+
+	var err error
+	if !self.Exited {
+		select {
+		case err = <-self.ExitChan:
+			if ctx.Verbose {
+				fmt.Printf("CommandExitedCondition: DONE! err=%v\n", err)
+			}
+
+			self.Duration = time.Since(self.StartTime)
+			// NB: exiting with a non-zero code still means the command exited
+			status, err := CommandExitStatus(err)
+			if err != nil {
+				return self, false, err
+			}
+
+			self.Exited = true
+			self.Status = &status
+		default:
+		}
+	}
+
+	if self.Descendants != nil {
+		err = self.Descendants.Scan(!self.Exited)
+		if err != nil {
+			return self, false, err
+		}
+
+		if ctx.Verbose {
+			fmt.Printf("CommandExitedCondition: command exited=%v, %d descendant(s) running\n", self.Exited, len(self.Descendants.Members))
+		}
+
+		if len(self.Descendants.Members) > 0 {
+			return self, false, nil
+		}
+	}
+
+	if !self.Exited {
+		return self, false, nil
+	}
+
+	self.Finished = true
+	self.TailFile, err = self.Output.WriteFile()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "CommandExitedCondition: unable to save the output's tail; err=%v\n", err)
+	}
+
+	return self, true, nil
+}
+
+/******************************************************************************/
+// CommandSucceedsCondition runs CommandStr until it exits 0, backing off
+// between attempts as the poll policy says. After MaxAttempts failures
+// (when it's set) the wait fails.
+type CommandSucceedsCondition struct {
+	CommandStr     string
+	MaxAttempts    int
+	AttemptTimeout time.Duration
+	Quiet          bool
+	TailLines      int
+	Attempts       int
+	Last           *ProbeResult
+	LastFailure    *ProbeResult
+	Succeeded      bool
+}
+
+func (self CommandSucceedsCondition) WaitingOn() WaitableThing {
+	return WaitOnCommandSucceeds
+}
+
+func (self CommandSucceedsCondition) Target() string {
+	return self.CommandStr
+}
+
+func (self CommandSucceedsCondition) Init(ctx *Context) (Condition, error) {
+	if self.TailLines <= 0 {
+		self.TailLines = DefaultTailLines
+	}
+
+	return self, nil
+}
+
+func (self CommandSucceedsCondition) PollPolicy() PollPolicy {
+	return PollPolicy{Interval: time.Second, MaxInterval: 30 * time.Second, BackoffFactor: 1.5}
+}
+
+func (self CommandSucceedsCondition) Details() map[string]string {
+	if self.Last == nil {
+		return nil
+	}
+
+	details := map[string]string{
+		"attempts": strconv.Itoa(self.Attempts),
+		"duration": self.Last.Duration.Round(time.Millisecond).String(),
+	}
+
+	if !self.Last.TimedOut {
+		maps.Copy(details, self.Last.Status.Details())
+	}
+
+	if self.LastFailure != nil {
+		details["last_failure"] = self.LastFailure.String()
+		details["last_failure_output"] = strings.Join(self.LastFailure.Output, "\n")
+	}
+
+	return details
+}
+
+func (self CommandSucceedsCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Succeeded {
+		return self, self.Succeeded, nil
+	}
+
+	result, err := RunProbe(ctx.Context(), self.CommandStr, self.AttemptTimeout, self.Quiet, self.TailLines)
+	if err != nil {
+		return self, false, err
+	}
+
+	self.Attempts++
+	self.Last = &result
+	if ctx.Verbose {
+		fmt.Printf("CommandSucceedsCondition: attempt %d %s after %v\n", self.Attempts, result, result.Duration.Round(time.Millisecond))
+	}
+
+	if result.Succeeded() {
+		self.Succeeded = true
+		return self, self.Succeeded, nil
+	}
+
+	self.LastFailure = &result
+	if self.MaxAttempts > 0 && self.Attempts >= self.MaxAttempts {
+		return self, false, fmt.Errorf("gave up after %d attempts, the last one %s", self.Attempts, result)
+	}
+
+	return self, false, nil
 }
 
 /******************************************************************************/
-type FileUpdatedCondition struct {
-	FileName string
-	FileInfo *fs.FileInfo
-	Changed  bool
+// CommandFailsCondition runs CommandStr over and over, until it fails:
+// exits non-zero (or with ExitCode when that's set), or times out, for
+// Consecutive runs in a row.
+type CommandFailsCondition struct {
+	CommandStr     string
+	ExitCode       *int
+	Consecutive    int
+	AttemptTimeout time.Duration
+	Quiet          bool
+	TailLines      int
+	Attempts       int
+	Failures       int
+	Last           *ProbeResult
+	Failed         bool
 }
 
-func (self FileUpdatedCondition) Init(ctx *Context) (Condition, error) {
-	fileInfo, err := os.Stat(self.FileName)
-	if err != nil {
-		return self, err
+func (self CommandFailsCondition) WaitingOn() WaitableThing {
+	return WaitOnCommandFails
+}
+
+func (self CommandFailsCondition) Target() string {
+	return self.CommandStr
+}
+
+func (self CommandFailsCondition) Init(ctx *Context) (Condition, error) {
+	if self.Consecutive <= 0 {
+		self.Consecutive = 1
+	}
+
+	if self.TailLines <= 0 {
+		self.TailLines = DefaultTailLines
 	}
 
-	self.FileInfo = &fileInfo
 	return self, nil
 }
 
-func (self FileUpdatedCondition) Check(ctx *Context) (Condition, bool, error) {
-	if self.Changed {
-		return self, self.Changed, nil
+func (self CommandFailsCondition) PollPolicy() PollPolicy {
+	return PollPolicy{Interval: time.Second, MaxInterval: 30 * time.Second, BackoffFactor: 1.5}
+}
+
+func (self CommandFailsCondition) Details() map[string]string {
+	if self.Last == nil {
+		return nil
 	}
 
-	fileInfo, err := os.Stat(self.FileName)
-	if err != nil {
-		return self, false, err
+	details := map[string]string{
+		"attempts":             strconv.Itoa(self.Attempts),
+		"consecutive_failures": strconv.Itoa(self.Failures),
+		"duration":             self.Last.Duration.Round(time.Millisecond).String(),
+		"result":               self.Last.String(),
+		"tail":                 strings.Join(self.Last.Output, "\n"),
 	}
 
-	if !(*self.FileInfo).ModTime().Equal(fileInfo.ModTime()) {
-		condition := FileUpdatedCondition{FileName: self.FileName, FileInfo: self.FileInfo, Changed: true}
-		return condition, condition.Changed, nil
+	if !self.Last.TimedOut {
+		maps.Copy(details, self.Last.Status.Details())
 	}
 
-	return self, self.Changed, nil
+	return details
 }
 
-/******************************************************************************/
-type DirExistsCondition struct {
-	DirName string
-	Exists  bool
-}
+// failed is whether result counts towards the Consecutive failures.
+func (self CommandFailsCondition) failed(result ProbeResult) bool {
+	if self.ExitCode != nil {
+		return !result.TimedOut && result.Status.Signal == 0 && result.Status.Code == *self.ExitCode
+	}
 
-func (self DirExistsCondition) Init(ctx *Context) (Condition, error) {
-	return self, nil
+	return !result.Succeeded()
 }
 
-func (self DirExistsCondition) Check(ctx *Context) (Condition, bool, error) {
-	if self.Exists {
-		return self, self.Exists, nil
-	}
-
-	fileInfo, err := os.Stat(self.DirName)
-	if err != nil && errors.Is(err, os.ErrNotExist) {
-		return self, false, nil
+func (self CommandFailsCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Failed {
+		return self, self.Failed, nil
 	}
 
+	result, err := RunProbe(ctx.Context(), self.CommandStr, self.AttemptTimeout, self.Quiet, self.TailLines)
 	if err != nil {
 		return self, false, err
 	}
 
-	// NB: has to be a directory
-	if !fileInfo.Mode().IsDir() {
-		return self, self.Exists, nil
+	self.Attempts++
+	self.Last = &result
+	if self.failed(result) {
+		self.Failures++
+	} else {
+		self.Failures = 0
 	}
 
-	condition := DirExistsCondition{DirName: self.DirName, Exists: true}
-	return condition, condition.Exists, nil
+	if ctx.Verbose {
+		fmt.Printf("CommandFailsCondition: attempt %d %s, %d/%d failures in a row\n", self.Attempts, result, self.Failures, self.Consecutive)
+	}
+
+	self.Failed = self.Failures >= self.Consecutive
+	return self, self.Failed, nil
 }
 
 /******************************************************************************/
-type DirRemovedCondition struct {
-	DirName string
-	Removed bool
-}
+const DefaultDialTimeout = 2 * time.Second
+
+// DialSocket makes a single connection attempt, it reports whether
+// something accepted the connection; refused connections, missing unix
+// domain sockets and attempts that time out are reported as not
+// listening rather than as errors.
+func DialSocket(ctx *Context, network, address string, timeout time.Duration) (bool, error) {
+	if network == "" {
+		network = "tcp"
+	}
 
-func (self DirRemovedCondition) Init(ctx *Context) (Condition, error) {
-	return self, nil
-}
+	if timeout == 0 {
+		timeout = DefaultDialTimeout
+	}
 
-func (self DirRemovedCondition) Check(ctx *Context) (Condition, bool, error) {
-	if self.Removed {
-		return self, self.Removed, nil
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx.Context(), network, address)
+	if err == nil {
+		conn.Close()
+		return true, nil
 	}
 
-	_, err := os.Stat(self.DirName)
-	if err != nil && errors.Is(err, os.ErrNotExist) {
-		return DirRemovedCondition{DirName: self.DirName, Removed: true}, true, nil
+	if ctx.Verbose {
+		fmt.Printf("DialSocket: network=%s address=%s err=%v\n", network, address, err)
 	}
 
-	if err != nil {
-		return self, false, err
+	// NB: a dial cut off by the deadline or an interrupt isn't a refusal,
+	// socket-refused would be met by it; the dialer gives up at the
+	// deadline a moment before the context is done
+	if deadline, ok := ctx.Context().Deadline(); ok && !time.Now().Before(deadline) {
+		<-ctx.Context().Done()
 	}
 
-	// it exists
-	return self, false, nil
+	if ctx.Context().Err() != nil {
+		return false, context.Cause(ctx.Context())
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT) {
+		return false, nil
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return false, nil
+	}
+
+	return false, err
 }
 
 /******************************************************************************/
-type DirUpdatedCondition struct {
-	DirName  string
-	FileInfo *fs.FileInfo
-	Changed  bool
+type SocketConnectCondition struct {
+	Succeeded   bool
+	Network     string
+	Address     string
+	DialTimeout time.Duration
 }
 
-func (self DirUpdatedCondition) Init(ctx *Context) (Condition, error) {
-	fileInfo, err := os.Stat(self.DirName)
-	if err != nil {
-		return self, err
-	}
+func (self SocketConnectCondition) WaitingOn() WaitableThing {
+	return WaitOnSocketConnect
+}
 
-	self.FileInfo = &fileInfo
+func (self SocketConnectCondition) Target() string {
+	return self.Address
+}
+
+func (self SocketConnectCondition) Init(ctx *Context) (Condition, error) {
 	return self, nil
 }
 
-func (self DirUpdatedCondition) Check(ctx *Context) (Condition, bool, error) {
-	if self.Changed {
-		return self, self.Changed, nil
+func (self SocketConnectCondition) PollPolicy() PollPolicy {
+	return PollPolicy{Interval: 250 * time.Millisecond, MaxInterval: 5 * time.Second, BackoffFactor: 1.5}
+}
+
+func (self SocketConnectCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Succeeded {
+		return self, self.Succeeded, nil
 	}
 
-	fileInfo, err := os.Stat(self.DirName)
+	listening, err := DialSocket(ctx, self.Network, self.Address, self.DialTimeout)
 	if err != nil {
 		return self, false, err
 	}
 
-	if ctx.Verbose {
-		fmt.Printf("DirUpdatedCondition: prev:%v curr:%v\n", (*self.FileInfo).ModTime(), fileInfo.ModTime())
-	}
-
-	if !(*self.FileInfo).ModTime().Equal(fileInfo.ModTime()) {
-		condition := DirUpdatedCondition{DirName: self.DirName, FileInfo: &fileInfo, Changed: true}
-		return condition, condition.Changed, nil
+	if !listening {
+		return self, false, nil
 	}
 
-	return self, false, nil
+	self.Succeeded = true
+	return self, true, nil
 }
 
 /******************************************************************************/
-type PidExitedCondition struct {
-	Pid    int
-	Exited bool
+type SocketRefusedCondition struct {
+	Refused     bool
+	Network     string
+	Address     string
+	DialTimeout time.Duration
 }
 
-func (self PidExitedCondition) Init(ctx *Context) (Condition, error) {
+func (self SocketRefusedCondition) WaitingOn() WaitableThing {
+	return WaitOnSocketRefused
+}
+
+func (self SocketRefusedCondition) Target() string {
+	return self.Address
+}
+
+func (self SocketRefusedCondition) Init(ctx *Context) (Condition, error) {
 	return self, nil
 }
 
-func (self PidExitedCondition) Check(ctx *Context) (Condition, bool, error) {
-	if self.Exited {
-		return self, self.Exited, nil
+func (self SocketRefusedCondition) PollPolicy() PollPolicy {
+	return PollPolicy{Interval: 250 * time.Millisecond, MaxInterval: 5 * time.Second, BackoffFactor: 1.5}
+}
+
+func (self SocketRefusedCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Refused {
+		return self, self.Refused, nil
 	}
 
-	pinfo, err := os.FindProcess(self.Pid)
+	listening, err := DialSocket(ctx, self.Network, self.Address, self.DialTimeout)
 	if err != nil {
 		return self, false, err
 	}
 
-	// the docs: https://pkg.go.dev/os#Process.Signal
-	// don't seem to distinguish the errors returned by Signal, we'll
-	// assume that nil means the process exists and non-nil means it
-	// does not.
-	err = pinfo.Signal(syscall.Signal(0))
-	if err == nil {
+	if listening {
 		return self, false, nil
 	}
 
-	return PidExitedCondition{Pid: self.Pid, Exited: true}, true, nil
+	self.Refused = true
+	return self, true, nil
 }
 
 /******************************************************************************/
-type CommandExitedCondition struct {
-	CommandStr string
-	Command    *exec.Cmd
-	Exited     bool
-	ExitChan   chan error
+type HttpOkCondition struct {
+	Url          string
+	Method       string
+	AcceptStatus []int
+	Headers      map[string]string
+	Insecure     bool
+	Timeout      time.Duration
+	Client       *http.Client
+	StatusCode   int
+	Succeeded    bool
 }
 
-func (self CommandExitedCondition) Init(ctx *Context) (Condition, error) {
-	// runtime.Breakpoint()
-	cmd := exec.Command("bash", "-c", self.CommandStr)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Start()
-
-	if err != nil {
-		return self, err
+func (self HttpOkCondition) WaitingOn() WaitableThing {
+	if strings.HasPrefix(strings.ToLower(self.Url), "https:") {
+		return WaitOnHttpsHeadOk
 	}
 
-	exitChan := make(chan error, 1)
-	go func() {
-		if ctx.Verbose {
-			fmt.Printf("CommandExitedCondition: START go func: calling cmd.Wait\n")
-		}
-		res := cmd.Wait()
-		exitChan <- res
-		if ctx.Verbose {
-			fmt.Printf("CommandExitedCondition: EXIT  go func: called cmd.Wait res=%v\n", res)
-		}
-	}()
+	return WaitOnHttpHeadOk
+}
 
-	return CommandExitedCondition{CommandStr: self.CommandStr, Command: cmd, Exited: false, ExitChan: exitChan}, nil
+func (self HttpOkCondition) Target() string {
+	return self.Url
 }
 
-func (self CommandExitedCondition) Check(ctx *Context) (Condition, bool, error) {
-	if self.Exited {
-		return self, self.Exited, nil
+func (self HttpOkCondition) Init(ctx *Context) (Condition, error) {
+	if self.Method == "" {
+		self.Method = http.MethodHead
 	}
 
-	var err error
-	done := false
-	select {
-	case err = <-self.ExitChan:
-		if ctx.Verbose {
-			fmt.Printf("CommandExitedCondition: DONE! err=%v\n", err)
-		}
-		done = true
-	default:
-		if ctx.Verbose {
-			fmt.Printf("CommandExitedCondition: default\n")
-		}
+	if len(self.AcceptStatus) == 0 {
+		self.AcceptStatus = []int{http.StatusOK}
+	}
+
+	if self.Timeout == 0 {
+		self.Timeout = 10 * time.Second
 	}
 
+	// NB: validate the request up front so a bad url is reported once
+	// rather than being retried forever
+	_, err := self.NewRequest()
 	if err != nil {
-		return self, false, err
+		return self, err
 	}
 
-	if done {
-		return CommandExitedCondition{CommandStr: self.CommandStr, Exited: true}, true, nil
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if self.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // nolint: gosec
 	}
 
-	// return self, false, nil
+	self.Client = &http.Client{Transport: transport, Timeout: self.Timeout}
+	return self, nil
+}
+
+func (self HttpOkCondition) PollPolicy() PollPolicy {
+	return PollPolicy{Interval: time.Second, MaxInterval: 30 * time.Second, BackoffFactor: 1.5}
+}
 
-	pinfo, err := os.FindProcess(self.Command.Process.Pid)
+func (self HttpOkCondition) NewRequest() (*http.Request, error) {
+	req, err := http.NewRequest(self.Method, self.Url, nil)
 	if err != nil {
-		return self, false, err
+		return nil, err
 	}
 
-	// the docs: https://pkg.go.dev/os#Process.Signal
-	// don't seem to distinguish the errors returned by Signal, we'll
-	// assume that nil means the process exists and non-nil means it
-	// does not.
-	err = pinfo.Signal(syscall.Signal(0))
-	if err == nil {
-		return self, false, nil
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, fmt.Errorf("HttpOkCondition: unsupported url scheme '%s' in url=%s", req.URL.Scheme, self.Url)
 	}
 
-	if err != nil && errors.Is(err, os.ErrProcessDone) {
-		return CommandExitedCondition{CommandStr: self.CommandStr, Command: nil, Exited: true}, true, nil
+	for name, value := range self.Headers {
+		req.Header.Set(name, value)
 	}
 
-	// if err was != nil, assume it means the process has exited, we'll need to clean up
-	_, err = pinfo.Wait() // returns ProcessState, error
+	return req, nil
+}
 
-	if err != nil {
-		errno, ok := err.(syscall.Errno)
-		if ok {
-			if errno == syscall.ECHILD {
-				// no child process (we waited for it)
-				return CommandExitedCondition{CommandStr: self.CommandStr, Command: nil, Exited: true}, true, nil
-			}
-		}
+func (self HttpOkCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.Succeeded {
+		return self, self.Succeeded, nil
 	}
 
+	req, err := self.NewRequest()
 	if err != nil {
 		return self, false, err
 	}
 
-	return CommandExitedCondition{CommandStr: self.CommandStr, Command: nil, Exited: true}, true, nil
-}
-
-/******************************************************************************/
-type CommandSucceedsCondition struct {
-	CommandStr string
-}
+	resp, err := self.Client.Do(req.WithContext(ctx.Context()))
+	if err != nil {
+		// NB: refused connections, dns failures, timeouts, etc are all
+		// expected while we wait for the service to come up
+		if ctx.Verbose {
+			fmt.Printf("HttpOkCondition: %s %s err=%v\n", self.Method, self.Url, err)
+		}
+		return self, false, nil
+	}
 
-func (self CommandSucceedsCondition) Init(ctx *Context) (Condition, error) {
-	return self, nil
-}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
 
-func (self CommandSucceedsCondition) Check(ctx *Context) (Condition, bool, error) {
-	cmd := exec.Command("bash", "-c", self.CommandStr)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Start()
-	if err != nil {
-		return self, false, err
+	if ctx.Verbose {
+		fmt.Printf("HttpOkCondition: %s %s status=%d\n", self.Method, self.Url, resp.StatusCode)
 	}
 
-	err = cmd.Wait()
-	if err, ok := err.(*exec.ExitError); ok {
-		return self, false, err
+	if !slices.Contains(self.AcceptStatus, resp.StatusCode) {
+		return self, false, nil
 	}
 
-	return CommandExitedCondition{CommandStr: self.CommandStr, Command: nil, Exited: true}, true, nil
+	self.StatusCode = resp.StatusCode
+	self.Succeeded = true
+	return self, true, nil
 }
 
 /******************************************************************************/
-type CommandFailsCondition struct {
-	CommandStr string
-	Command    *exec.Cmd
-	Exited     bool
-	ExitChan   chan error
-}
+const (
+	CompositeAllOf = "all-of"
+	CompositeAnyOf = "any-of"
+	CompositeNOf   = "n-of"
+)
 
-func (self CommandFailsCondition) Init(ctx *Context) (Condition, error) {
-	return self, nil
+// CompositeCondition waits on several child conditions, it is met once
+// all, any or at least Need of them have been met. Children are not
+// re-checked once they have been met.
+type CompositeCondition struct {
+	Mode     string
+	Need     int
+	Children []Condition
+	Fired    []bool
 }
 
-func (self CommandFailsCondition) Check(ctx *Context) (Condition, bool, error) {
-	if self.Exited {
-		return self, self.Exited, nil
+func (self CompositeCondition) WaitingOn() WaitableThing {
+	switch self.Mode {
+	case CompositeAllOf:
+		return WaitOnAllOf
+	case CompositeAnyOf:
+		return WaitOnAnyOf
 	}
 
-	var err error
-	done := false
-	select {
-	case err = <-self.ExitChan:
-		if ctx.Verbose {
-			fmt.Printf("CommandExitedCondition: DONE! err=%v\n", err)
-		}
-		done = true
-	default:
-		if ctx.Verbose {
-			fmt.Printf("CommandExitedCondition: default\n")
-		}
-	}
+	return WaitOnNOf
+}
 
-	if err != nil {
-		return self, false, err
+func (self CompositeCondition) Target() string {
+	var descriptions []string
+	for _, child := range self.Children {
+		descriptions = append(descriptions, Describe(child))
 	}
 
-	if done {
-		return CommandExitedCondition{CommandStr: self.CommandStr, Exited: true}, true, nil
+	return fmt.Sprintf("%d of [%s]", self.Needed(), strings.Join(descriptions, "; "))
+}
+
+func (self CompositeCondition) Needed() int {
+	switch self.Mode {
+	case CompositeAllOf:
+		return len(self.Children)
+	case CompositeAnyOf:
+		return 1
 	}
 
-	// return self, false, nil
+	return self.Need
+}
 
-	pinfo, err := os.FindProcess(self.Command.Process.Pid)
-	if err != nil {
-		return self, false, err
+func (self CompositeCondition) FiredCount() int {
+	count := 0
+	for _, fired := range self.Fired {
+		if fired {
+			count++
+		}
 	}
 
-	// the docs: https://pkg.go.dev/os#Process.Signal
-	// don't seem to distinguish the errors returned by Signal, we'll
-	// assume that nil means the process exists and non-nil means it
-	// does not.
-	err = pinfo.Signal(syscall.Signal(0))
-	if err == nil {
-		return self, false, nil
+	return count
+}
+
+func (self CompositeCondition) Details() map[string]string {
+	var fired []string
+	for idx, child := range self.Children {
+		if idx < len(self.Fired) && self.Fired[idx] {
+			fired = append(fired, Describe(child))
+		}
 	}
 
-	if err != nil && errors.Is(err, os.ErrProcessDone) {
-		return CommandExitedCondition{CommandStr: self.CommandStr, Command: nil, Exited: true}, true, nil
+	return map[string]string{
+		"fired":       strings.Join(fired, "\n"),
+		"fired_count": strconv.Itoa(len(fired)),
 	}
+}
 
-	// if err was != nil, assume it means the process has exited, we'll need to clean up
-	_, err = pinfo.Wait() // returns ProcessState, error
+// Unexpected joins what was unexpected about each of the children that
+// were met, so that eg: an all-of isn't met by a process exiting with the
+// wrong code.
+func (self CompositeCondition) Unexpected() error {
+	var errs []error
+	for idx, child := range self.Children {
+		if idx >= len(self.Fired) || !self.Fired[idx] {
+			continue
+		}
 
-	if err != nil {
-		errno, ok := err.(syscall.Errno)
-		if ok {
-			if errno == syscall.ECHILD {
-				// no child process (we waited for it)
-				return CommandExitedCondition{CommandStr: self.CommandStr, Command: nil, Exited: true}, true, nil
-			}
+		if expecter, ok := child.(Expecter); ok {
+			errs = append(errs, expecter.Unexpected())
 		}
 	}
 
-	if err != nil {
-		return self, false, err
+	return errors.Join(errs...)
+}
+
+// PollPolicy is the policy of the child that wants to be checked most often.
+func (self CompositeCondition) PollPolicy() PollPolicy {
+	policy := PollPolicyFor(PollPolicy{}, self.Children[0])
+	for _, child := range self.Children[1:] {
+		childPolicy := PollPolicyFor(PollPolicy{}, child)
+		if childPolicy.Interval < policy.Interval {
+			policy = childPolicy
+		}
 	}
 
-	return CommandExitedCondition{CommandStr: self.CommandStr, Command: nil, Exited: true}, true, nil
+	return policy
 }
 
-/******************************************************************************/
-type SocketConnectCondition struct {
-	Succeeded bool
-	Address   string
+func (self CompositeCondition) Watch(ctx *Context, watch *FileWatch) (Condition, error) {
+	var errs []error
+	children := slices.Clone(self.Children)
+	for idx, child := range children {
+		watchable, ok := child.(Watchable)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: can not be watched", Describe(child)))
+			continue
+		}
+
+		var err error
+		children[idx], err = watchable.Watch(ctx, watch)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", Describe(child), err))
+		}
+	}
+
+	self.Children = children
+	return self, errors.Join(errs...)
 }
 
-func (self SocketConnectCondition) Init(ctx *Context) (Condition, error) {
-	return self, nil
+func (self CompositeCondition) WakeOn() []<-chan struct{} {
+	var wakes []<-chan struct{}
+	for _, child := range self.Children {
+		if waker, ok := child.(Waker); ok {
+			wakes = append(wakes, waker.WakeOn()...)
+		}
+	}
+
+	return wakes
 }
 
-func (self SocketConnectCondition) Check(ctx *Context) (Condition, bool, error) {
-	if self.Succeeded {
-		return self, self.Succeeded, nil
+func (self CompositeCondition) Close() error {
+	var errs []error
+	for _, child := range self.Children {
+		if closer, ok := child.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
 	}
 
-	dialer := net.Dialer{Timeout: 0}
-	conn, err := dialer.Dial("tcp", self.Address)
-	if err != nil && errors.Is(err, syscall.ECONNREFUSED) {
-		return self, false, nil
+	return errors.Join(errs...)
+}
+
+func (self CompositeCondition) Init(ctx *Context) (Condition, error) {
+	if len(self.Children) == 0 {
+		return self, fmt.Errorf("CompositeCondition: %s requires at least one condition", self.Mode)
 	}
 
-	if err != nil {
-		return self, false, err
+	if self.Needed() < 1 || self.Needed() > len(self.Children) {
+		return self, fmt.Errorf("CompositeCondition: %s needs %d of %d conditions, which can never be met", self.Mode, self.Needed(), len(self.Children))
 	}
 
-	defer conn.Close()
+	children := make([]Condition, len(self.Children))
+	for idx, child := range self.Children {
+		var err error
+		children[idx], err = child.Init(ctx)
+		if err != nil {
+			// NB: the ones already initialized may have started commands
+			// or opened files, nothing else will close them
+			_ = CompositeCondition{Children: children[:idx]}.Close()
+			return self, fmt.Errorf("%s: %w", Describe(child), err)
+		}
+	}
 
-	return SocketConnectCondition{Succeeded: true, Address: self.Address}, true, nil
+	self.Children = children
+	self.Fired = make([]bool, len(children))
+	return self, nil
 }
 
-/******************************************************************************/
-// TODO: HttpHeadOkCondition
+func (self CompositeCondition) Check(ctx *Context) (Condition, bool, error) {
+	if self.FiredCount() >= self.Needed() {
+		return self, true, nil
+	}
 
-/******************************************************************************/
-// TODO: HttpsHeadOkCondition
+	children := slices.Clone(self.Children)
+	fired := make([]bool, len(children))
+	copy(fired, self.Fired)
+	for idx, child := range children {
+		if fired[idx] {
+			continue
+		}
+
+		var err error
+		children[idx], fired[idx], err = child.Check(ctx)
+		if err != nil {
+			// NB: keep what the other children did this pass, Close has
+			// to see eg: a command that finished, a file that was reopened
+			self.Children = children
+			self.Fired = fired
+			return self, false, fmt.Errorf("%s: %w", Describe(child), err)
+		}
+
+		if fired[idx] && ctx.Verbose {
+			fmt.Printf("CompositeCondition: fired: %s\n", Describe(child))
+		}
+	}
+
+	self.Children = children
+	self.Fired = fired
+	return self, self.FiredCount() >= self.Needed(), nil
+}
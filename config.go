@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+/******************************************************************************/
+// Config is the json file format read by --config, see sample-config.json
+type Config struct {
+	WaitOn                string
+	NotifyType            string
+	DoNotify              bool
+	NotifyEverySeconds    int
+	FileName              string
+	Detect                []string
+	Pattern               string
+	ErrorPattern          string
+	FromStart             bool
+	Count                 int
+	AtLeast               int
+	AtMost                int
+	QuietForSeconds       int
+	Hash                  bool
+	MinSize               int64
+	DirName               string
+	Recursive             bool
+	Include               []string
+	Exclude               []string
+	Pid                   int
+	Match                 string
+	MatchFull             bool
+	User                  string
+	ParentPid             int
+	Any                   bool
+	NewOnly               bool
+	PidExitCode           *int
+	ExpectExit            []string
+	ExpectSignal          []string
+	Tree                  bool
+	Command               string
+	TailLines             int
+	MaxAttempts           int
+	AttemptTimeoutSeconds int
+	Quiet                 bool
+	ExitCode              *int
+	Consecutive           int
+	UseHttps              bool
+	HostOrAddress         string
+	Port                  string
+	Url                   string
+	NotifyCommand         string
+	NotifyUrl             string
+	NotifyOn              string
+	Message               string
+	Conditions            []Config
+	Need                  int
+}
+
+func LoadConfig(fname string) (Config, error) {
+	var config Config
+	contents, err := os.ReadFile(fname)
+	if err != nil {
+		return config, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&config)
+	if err != nil {
+		return config, fmt.Errorf("%s: invalid config: %w", fname, err)
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return config, fmt.Errorf("%s: invalid config: %w", fname, err)
+	}
+
+	return config, nil
+}
+
+func (self Config) Validate() error {
+	var errs []error
+	require := func(field string, present bool) {
+		if !present {
+			errs = append(errs, fmt.Errorf("WaitOn=%s requires %s", self.WaitOn, field))
+		}
+	}
+
+	switch StringToWaitableThing(self.WaitOn) {
+	case WaitOnFileExists, WaitOnFileRemoved:
+		require("FileName", self.FileName != "")
+		err := ValidateGlob(self.FileName)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	case WaitOnFileChanged:
+		require("FileName", self.FileName != "")
+		_, err := ParseDetectMode(self.Detect)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	case WaitOnFileContains:
+		require("FileName", self.FileName != "")
+		require("Pattern", self.Pattern != "")
+	case WaitOnFileStable:
+		require("FileName", self.FileName != "")
+		require("QuietForSeconds", self.QuietForSeconds > 0)
+	case WaitOnDirExists, WaitOnDirRemoved:
+		require("DirName", self.DirName != "")
+	case WaitOnDirChanged:
+		require("DirName", self.DirName != "")
+		require("Recursive for Include and Exclude", self.Recursive || len(self.Include)+len(self.Exclude) == 0)
+		for _, pattern := range slices.Concat(self.Include, self.Exclude) {
+			err := ValidateGlob(pattern)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	case WaitOnPidExit:
+		require("Pid", self.Pid > 0)
+		_, err := self.ExitExpectation()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	case WaitOnCommandExit:
+		require("Command", self.Command != "")
+		_, err := self.ExitExpectation()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	case WaitOnCommandSucceeds, WaitOnCommandFails:
+		require("Command", self.Command != "")
+	case WaitOnProcExits, WaitOnProcStarted:
+		_, err := NewProcMatcher(self.Match, self.MatchFull, self.User, self.ParentPid)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	case WaitOnSocketConnect, WaitOnSocketRefused:
+		require("HostOrAddress", self.HostOrAddress != "")
+		require("Port", self.Port != "")
+	case WaitOnHttpHeadOk, WaitOnHttpsHeadOk:
+		require("Url or HostOrAddress", self.Url != "" || self.HostOrAddress != "")
+	case WaitOnAllOf, WaitOnAnyOf, WaitOnNOf:
+		require("Conditions", len(self.Conditions) > 0)
+		if StringToWaitableThing(self.WaitOn) == WaitOnNOf {
+			require("Need", self.Need > 0 && self.Need <= len(self.Conditions))
+		}
+
+		for idx, child := range self.Conditions {
+			err := child.Validate()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Conditions[%d]: %w", idx, err))
+			}
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unrecognized WaitOn='%s'", self.WaitOn))
+	}
+
+	if self.DoNotify {
+		_, ok := StringToNotificationTypeTable[self.NotifyType]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("unrecognized NotifyType='%s'", self.NotifyType))
+		case StringToNotificationType(self.NotifyType) == NotifyViaCommand:
+			if self.NotifyCommand == "" {
+				errs = append(errs, fmt.Errorf("NotifyType=%s requires NotifyCommand", self.NotifyType))
+			}
+		default:
+			if self.NotifyUrl == "" {
+				errs = append(errs, fmt.Errorf("NotifyType=%s requires NotifyUrl", self.NotifyType))
+			}
+		}
+	}
+
+	switch self.NotifyOn {
+	case "", "success", "failure", "error", "timeout", "interrupt":
+	default:
+		errs = append(errs, fmt.Errorf("unrecognized NotifyOn='%s', expected success, failure, error, timeout or interrupt", self.NotifyOn))
+	}
+
+	if self.MaxAttempts < 0 || self.AttemptTimeoutSeconds < 0 || self.Consecutive < 0 {
+		errs = append(errs, fmt.Errorf("MaxAttempts, AttemptTimeoutSeconds and Consecutive must not be negative"))
+	}
+
+	if self.NotifyEverySeconds < 0 {
+		errs = append(errs, fmt.Errorf("NotifyEverySeconds must not be negative, got %d", self.NotifyEverySeconds))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (self Config) HttpUrl() string {
+	if self.Url != "" {
+		return self.Url
+	}
+
+	scheme := "http"
+	if self.UseHttps || StringToWaitableThing(self.WaitOn) == WaitOnHttpsHeadOk {
+		scheme = "https"
+	}
+
+	host := self.HostOrAddress
+	if self.Port != "" {
+		host = net.JoinHostPort(self.HostOrAddress, self.Port)
+	}
+
+	return scheme + "://" + host + "/"
+}
+
+// ExitExpectation is ExpectExit and ExpectSignal, PidExitCode is the same
+// as an ExpectExit of just that code.
+func (self Config) ExitExpectation() (*ExitExpectation, error) {
+	codes := self.ExpectExit
+	if self.PidExitCode != nil {
+		codes = append(slices.Clone(codes), strconv.Itoa(*self.PidExitCode))
+	}
+
+	return ParseExitExpectation(codes, self.ExpectSignal)
+}
+
+func (self Config) Condition() (Condition, error) {
+	switch StringToWaitableThing(self.WaitOn) {
+	case WaitOnFileExists:
+		return FileExistsCondition{FileName: self.FileName, AtLeast: self.AtLeast}, nil
+	case WaitOnFileRemoved:
+		return FileRemovedCondition{FileName: self.FileName, AtMost: self.AtMost}, nil
+	case WaitOnFileChanged:
+		detect, err := ParseDetectMode(self.Detect)
+		if err != nil {
+			return nil, err
+		}
+
+		return FileUpdatedCondition{FileName: self.FileName, Detect: detect}, nil
+	case WaitOnFileStable:
+		quietFor := time.Duration(self.QuietForSeconds) * time.Second
+		return FileStableCondition{FileName: self.FileName, QuietFor: quietFor, Hash: self.Hash, MinSize: self.MinSize}, nil
+	case WaitOnFileContains:
+		return NewFileContainsCondition(self.FileName, self.Pattern, self.ErrorPattern, self.FromStart, self.Count)
+	case WaitOnDirExists:
+		return DirExistsCondition{DirName: self.DirName}, nil
+	case WaitOnDirRemoved:
+		return DirRemovedCondition{DirName: self.DirName}, nil
+	case WaitOnDirChanged:
+		return DirUpdatedCondition{DirName: self.DirName, Recursive: self.Recursive, Include: self.Include, Exclude: self.Exclude}, nil
+	case WaitOnPidExit:
+		expect, err := self.ExitExpectation()
+		if err != nil {
+			return nil, err
+		}
+
+		return PidExitedCondition{Pid: self.Pid, Expect: expect, Tree: self.Tree}, nil
+	case WaitOnCommandExit:
+		expect, err := self.ExitExpectation()
+		if err != nil {
+			return nil, err
+		}
+
+		return CommandExitedCondition{CommandStr: self.Command, TailLines: self.TailLines, Expect: expect, Tree: self.Tree}, nil
+	case WaitOnCommandSucceeds:
+		return CommandSucceedsCondition{
+			CommandStr:     self.Command,
+			MaxAttempts:    self.MaxAttempts,
+			AttemptTimeout: time.Duration(self.AttemptTimeoutSeconds) * time.Second,
+			Quiet:          self.Quiet,
+			TailLines:      self.TailLines,
+		}, nil
+	case WaitOnCommandFails:
+		return CommandFailsCondition{
+			CommandStr:     self.Command,
+			ExitCode:       self.ExitCode,
+			Consecutive:    self.Consecutive,
+			AttemptTimeout: time.Duration(self.AttemptTimeoutSeconds) * time.Second,
+			Quiet:          self.Quiet,
+			TailLines:      self.TailLines,
+		}, nil
+	case WaitOnSocketConnect:
+		return SocketConnectCondition{Address: net.JoinHostPort(self.HostOrAddress, self.Port)}, nil
+	case WaitOnSocketRefused:
+		return SocketRefusedCondition{Address: net.JoinHostPort(self.HostOrAddress, self.Port)}, nil
+	case WaitOnHttpHeadOk, WaitOnHttpsHeadOk:
+		return HttpOkCondition{Url: self.HttpUrl(), Method: http.MethodHead}, nil
+	case WaitOnProcExits:
+		matcher, err := NewProcMatcher(self.Match, self.MatchFull, self.User, self.ParentPid)
+		if err != nil {
+			return nil, err
+		}
+
+		return ProcExitedCondition{Matcher: matcher, Any: self.Any}, nil
+	case WaitOnProcStarted:
+		matcher, err := NewProcMatcher(self.Match, self.MatchFull, self.User, self.ParentPid)
+		if err != nil {
+			return nil, err
+		}
+
+		return ProcStartedCondition{Matcher: matcher, NewOnly: self.NewOnly}, nil
+	case WaitOnAllOf, WaitOnAnyOf, WaitOnNOf:
+		return self.CompositeCondition()
+	}
+
+	return nil, fmt.Errorf("unrecognized WaitOn='%s'", self.WaitOn)
+}
+
+func (self Config) CompositeCondition() (Condition, error) {
+	condition := CompositeCondition{Mode: CompositeNOf, Need: self.Need}
+	switch StringToWaitableThing(self.WaitOn) {
+	case WaitOnAllOf:
+		condition.Mode = CompositeAllOf
+	case WaitOnAnyOf:
+		condition.Mode = CompositeAnyOf
+	}
+
+	for idx, config := range self.Conditions {
+		child, err := config.Condition()
+		if err != nil {
+			return nil, fmt.Errorf("Conditions[%d]: %w", idx, err)
+		}
+
+		condition.Children = append(condition.Children, child)
+	}
+
+	return condition, nil
+}
+
+// Apply adds the config's notification settings to ctx.
+func (self Config) Apply(ctx *Context) error {
+	if self.NotifyEverySeconds > 0 {
+		ctx.NotifyEvery = time.Duration(self.NotifyEverySeconds) * time.Second
+	}
+
+	if self.Message != "" {
+		tmpl, err := ParseTemplate("Message", self.Message)
+		if err != nil {
+			return err
+		}
+
+		ctx.MessageTemplate = tmpl
+	}
+
+	if !self.DoNotify {
+		return nil
+	}
+
+	notificationType := StringToNotificationType(self.NotifyType)
+	target := self.NotifyUrl
+	if notificationType == NotifyViaCommand {
+		target = self.NotifyCommand
+	}
+
+	notification, err := NewNotification(notificationType, target)
+	if err != nil {
+		return err
+	}
+
+	// NB: like --on-success, --on-failure, --on-error, --on-timeout-run
+	// and --on-interrupt
+	switch self.NotifyOn {
+	case "success":
+		ctx.SuccessNotifiers = append(ctx.SuccessNotifiers, notification)
+	case "failure":
+		ctx.FailureNotifiers = append(ctx.FailureNotifiers, notification)
+	case "error":
+		ctx.ErrorNotifiers = append(ctx.ErrorNotifiers, notification)
+	case "timeout":
+		ctx.TimeoutNotifiers = append(ctx.TimeoutNotifiers, notification)
+	case "interrupt":
+		ctx.InterruptNotifiers = append(ctx.InterruptNotifiers, notification)
+	default:
+		ctx.Notifiers = append(ctx.Notifiers, notification)
+	}
+
+	return nil
+}
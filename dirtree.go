@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DirTree is a snapshot of the entries under Root. Rescan only re-reads
+// the directories it's told have changed, so that a large tree isn't
+// walked on every check.
+type DirTree struct {
+	Root    string
+	Include []string
+	Exclude []string
+	// the entries of each directory, keyed by its path relative to Root
+	Dirs map[string]map[string]fs.FileInfo
+}
+
+// DirChanges summarizes what changed between two snapshots of a DirTree,
+// paths are relative to its Root and directories end in a /
+type DirChanges struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+	Renamed  []string
+	// directories that are new to the tree, they need to be watched
+	newDirs []string
+}
+
+type dirDiff struct {
+	added    map[string]fs.FileInfo
+	removed  map[string]fs.FileInfo
+	modified []string
+}
+
+func NewDirTree(root string, include, exclude []string) (*DirTree, error) {
+	tree := &DirTree{
+		Root:    filepath.Clean(root),
+		Include: include,
+		Exclude: exclude,
+		Dirs:    map[string]map[string]fs.FileInfo{},
+	}
+
+	rootInfo, err := os.Stat(tree.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	if !rootInfo.IsDir() {
+		return nil, &fs.PathError{Op: "scan", Path: tree.Root, Err: errors.New("not a directory")}
+	}
+
+	tree.add(".", rootInfo, &dirDiff{added: map[string]fs.FileInfo{}})
+	return tree, nil
+}
+
+// DirNames are the directories in the tree, rescanning all of them is a
+// full rescan.
+func (self *DirTree) DirNames() []string {
+	names := make([]string, 0, len(self.Dirs))
+	for name := range self.Dirs {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// Excluded directories aren't descended in to.
+func (self *DirTree) Excluded(rel string) bool {
+	return MatchesAnyPath(self.Exclude, rel)
+}
+
+func (self *DirTree) Included(rel string, isDir bool) bool {
+	if len(self.Include) == 0 {
+		return true
+	}
+
+	return !isDir && MatchesAnyPath(self.Include, rel)
+}
+
+func (self *DirTree) read(dir string) (map[string]fs.FileInfo, error) {
+	entries, err := os.ReadDir(filepath.Join(self.Root, dir))
+	if err != nil {
+		return nil, err
+	}
+
+	infos := map[string]fs.FileInfo{}
+	for _, entry := range entries {
+		if self.Excluded(filepath.Join(dir, entry.Name())) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		infos[entry.Name()] = info
+	}
+
+	return infos, nil
+}
+
+func (self *DirTree) add(rel string, info fs.FileInfo, diff *dirDiff) {
+	diff.added[rel] = info
+	if !info.IsDir() {
+		return
+	}
+
+	// NB: a directory that can't be read (eg: it was removed again) is
+	// treated as empty
+	entries, _ := self.read(rel)
+	self.Dirs[rel] = entries
+	for name, child := range entries {
+		self.add(filepath.Join(rel, name), child, diff)
+	}
+}
+
+func (self *DirTree) remove(rel string, info fs.FileInfo, diff *dirDiff) {
+	diff.removed[rel] = info
+	if !info.IsDir() {
+		return
+	}
+
+	for name, child := range self.Dirs[rel] {
+		self.remove(filepath.Join(rel, name), child, diff)
+	}
+
+	delete(self.Dirs, rel)
+}
+
+// Rescan re-reads dirs, directories that have been added are scanned in
+// full, ones that have been removed are dropped along with everything
+// under them.
+func (self *DirTree) Rescan(dirs []string) (DirChanges, error) {
+	diff := dirDiff{added: map[string]fs.FileInfo{}, removed: map[string]fs.FileInfo{}}
+
+	// NB: parents sort before their children, a child that the parent's
+	// rescan removed is skipped
+	dirs = slices.Clone(dirs)
+	slices.Sort(dirs)
+	dirs = slices.Compact(dirs)
+	for _, dir := range dirs {
+		previous, known := self.Dirs[dir]
+		if !known {
+			continue
+		}
+
+		current, err := self.read(dir)
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && dir == ".":
+			current = map[string]fs.FileInfo{}
+		case errors.Is(err, fs.ErrNotExist):
+			// NB: it's reported as removed when its parent is rescanned
+			continue
+		case err != nil:
+			return DirChanges{}, err
+		}
+
+		for name, info := range current {
+			rel := filepath.Join(dir, name)
+			prev, existed := previous[name]
+			switch {
+			case existed && prev.IsDir() != info.IsDir():
+				self.remove(rel, prev, &diff)
+				self.add(rel, info, &diff)
+			case !existed:
+				self.add(rel, info, &diff)
+			case !info.IsDir() && (prev.Size() != info.Size() || !prev.ModTime().Equal(info.ModTime()) || prev.Mode() != info.Mode()):
+				diff.modified = append(diff.modified, rel)
+			}
+		}
+
+		for name, prev := range previous {
+			if _, ok := current[name]; !ok {
+				self.remove(filepath.Join(dir, name), prev, &diff)
+			}
+		}
+
+		self.Dirs[dir] = current
+	}
+
+	return self.summarize(diff), nil
+}
+
+// summarize pairs up the entries that were removed and added as the same
+// file (a rename), and applies Include.
+func (self *DirTree) summarize(diff dirDiff) DirChanges {
+	var changes DirChanges
+	display := func(rel string, info fs.FileInfo) string {
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			return rel + "/"
+		}
+
+		return rel
+	}
+
+	for from, fromInfo := range diff.removed {
+		for to, toInfo := range diff.added {
+			if !sameEntry(fromInfo, toInfo) {
+				continue
+			}
+
+			if self.Included(from, fromInfo.IsDir()) || self.Included(to, toInfo.IsDir()) {
+				changes.Renamed = append(changes.Renamed, display(from, fromInfo)+" -> "+display(to, toInfo))
+			}
+
+			delete(diff.removed, from)
+			delete(diff.added, to)
+			break
+		}
+	}
+
+	for rel, info := range diff.added {
+		if info.IsDir() {
+			changes.newDirs = append(changes.newDirs, rel)
+		}
+
+		if self.Included(rel, info.IsDir()) {
+			changes.Added = append(changes.Added, display(rel, info))
+		}
+	}
+
+	for rel, info := range diff.removed {
+		if self.Included(rel, info.IsDir()) {
+			changes.Removed = append(changes.Removed, display(rel, info))
+		}
+	}
+
+	for _, rel := range diff.modified {
+		if self.Included(rel, false) {
+			changes.Modified = append(changes.Modified, filepath.ToSlash(rel))
+		}
+	}
+
+	slices.Sort(changes.Added)
+	slices.Sort(changes.Removed)
+	slices.Sort(changes.Modified)
+	slices.Sort(changes.Renamed)
+	return changes
+}
+
+// sameEntry reports whether from and to are the same file, renaming a
+// file doesn't change its size or mtime.
+//
+// NB: the inode of a removed file may already have been reused, it's not
+// enough on its own
+func sameEntry(from, to fs.FileInfo) bool {
+	if !os.SameFile(from, to) || from.IsDir() != to.IsDir() {
+		return false
+	}
+
+	return from.IsDir() || (from.Size() == to.Size() && from.ModTime().Equal(to.ModTime()))
+}
+
+func (self DirChanges) Count() int {
+	return len(self.Added) + len(self.Removed) + len(self.Modified) + len(self.Renamed)
+}
+
+func (self DirChanges) Details() map[string]string {
+	return map[string]string{
+		"change_count": strconv.Itoa(self.Count()),
+		"added":        strings.Join(self.Added, "\n"),
+		"removed":      strings.Join(self.Removed, "\n"),
+		"modified":     strings.Join(self.Modified, "\n"),
+		"renamed":      strings.Join(self.Renamed, "\n"),
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// exit codes reported by tellmewhen, see the README for details
+const (
+	ExitSuccess        = 0
+	ExitConditionError = 1
+	ExitBadArguments   = 2
+	ExitInitFailed     = 3
+	ExitNotifyFailed   = 4
+	// NB: not the process's own status, that would clash with the others,
+	// it's in the details (TMW_EXIT_CODE)
+	ExitUnexpectedExit = 5
+	ExitUnknownExit    = 6
+	ExitTimeout        = 124
+	ExitInterrupted    = 130
+)
+
+/******************************************************************************/
+// BadArgumentsError is a command line or config file that doesn't
+// describe a wait tellmewhen can do.
+type BadArgumentsError struct {
+	Err error
+}
+
+func (self *BadArgumentsError) Error() string {
+	return fmt.Sprintf("invalid arguments: %v", self.Err)
+}
+
+func (self *BadArgumentsError) Unwrap() error {
+	return self.Err
+}
+
+/******************************************************************************/
+// InitError is a condition that couldn't be set up, eg: a command that
+// couldn't be started.
+type InitError struct {
+	Description string
+	Err         error
+}
+
+func (self *InitError) Error() string {
+	return fmt.Sprintf("unable to start waiting on %s: %v", self.Description, self.Err)
+}
+
+func (self *InitError) Unwrap() error {
+	return self.Err
+}
+
+/******************************************************************************/
+// CheckError is a condition that couldn't be checked, eg: the file
+// being watched for updates was removed.
+type CheckError struct {
+	Description string
+	Err         error
+}
+
+func (self *CheckError) Error() string {
+	return fmt.Sprintf("unable to check %s: %v", self.Description, self.Err)
+}
+
+func (self *CheckError) Unwrap() error {
+	return self.Err
+}
+
+/******************************************************************************/
+// NotifyError is the condition having been met, but one or more of the
+// notifications not being sent.
+type NotifyError struct {
+	Err error
+}
+
+func (self *NotifyError) Error() string {
+	return fmt.Sprintf("unable to notify: %v", self.Err)
+}
+
+func (self *NotifyError) Unwrap() error {
+	return self.Err
+}
+
+/******************************************************************************/
+type TimeoutError struct {
+	StartTime time.Time
+	Deadline  time.Time
+}
+
+func (self *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s waiting for the condition (deadline=%s)",
+		self.Deadline.Sub(self.StartTime).Round(time.Millisecond), self.Deadline.Format(time.RFC3339))
+}
+
+/******************************************************************************/
+// InterruptedError is the wait being stopped by a signal.
+type InterruptedError struct {
+	Signal os.Signal
+}
+
+func (self *InterruptedError) Error() string {
+	return fmt.Sprintf("interrupted by %v", self.Signal)
+}
+
+/******************************************************************************/
+// UnexpectedExitError is a process having exited, but not the way
+// --expect-exit or --expect-signal hoped it would.
+type UnexpectedExitError struct {
+	Description string
+	Status      *ExitStatus
+	Expected    string
+}
+
+func (self *UnexpectedExitError) Error() string {
+	return fmt.Sprintf("%s %s, expected %s", self.Description, self.Status, self.Expected)
+}
+
+// UnknownExitError is a process having exited without there being any
+// telling how (eg: pid-exits on a process its parent already reaped), so
+// --expect-exit or --expect-signal can't be checked.
+type UnknownExitError struct {
+	Description string
+	Expected    string
+}
+
+func (self *UnknownExitError) Error() string {
+	return fmt.Sprintf("%s exited, unable to tell how (it was reaped, or isn't ours), expected %s", self.Description, self.Expected)
+}
+
+/******************************************************************************/
+func ExitCodeForError(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+
+	var badArgumentsErr *BadArgumentsError
+	var initErr *InitError
+	var notifyErr *NotifyError
+	var timeoutErr *TimeoutError
+	var interruptedErr *InterruptedError
+	var unexpectedExitErr *UnexpectedExitError
+	var unknownExitErr *UnknownExitError
+	switch {
+	case errors.As(err, &badArgumentsErr):
+		return ExitBadArguments
+	case errors.As(err, &initErr):
+		return ExitInitFailed
+	case errors.As(err, &notifyErr):
+		return ExitNotifyFailed
+	case errors.As(err, &timeoutErr):
+		return ExitTimeout
+	case errors.As(err, &interruptedErr), errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	case errors.As(err, &unexpectedExitErr):
+		return ExitUnexpectedExit
+	case errors.As(err, &unknownExitErr):
+		return ExitUnknownExit
+	}
+
+	return ExitConditionError
+}
+
+// ErrorSummary is the one line printed for err, errors.Join'd errors
+// (eg: several failed notifications) are only counted, --verbose
+// prints all of them.
+func ErrorSummary(err error) string {
+	first, rest, found := strings.Cut(err.Error(), "\n")
+	if !found {
+		return first
+	}
+
+	return fmt.Sprintf("%s (and %d more, see --verbose)", first, strings.Count(rest, "\n")+1)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IsGlob reports whether pattern has any glob meta characters, paths
+// without them are taken literally.
+func IsGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+func splitPath(name string) []string {
+	return strings.Split(filepath.ToSlash(filepath.Clean(name)), "/")
+}
+
+// ValidateGlob reports a malformed pattern, eg: an unclosed [
+func ValidateGlob(pattern string) error {
+	for _, part := range splitPath(pattern) {
+		_, err := path.Match(part, "")
+		if err != nil {
+			return fmt.Errorf("invalid glob '%s': %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// GlobFiles is filepath.Glob, plus ** matching any number of
+// directories, eg: out/**/part-*.parquet
+func GlobFiles(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+
+	patternParts := splitPath(pattern)
+	var matches []string
+	err := filepath.WalkDir(GlobRoot(pattern), func(name string, entry fs.DirEntry, err error) error {
+		// NB: a missing root is no matches, unreadable directories are
+		// skipped the way filepath.Glob skips them
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		matched, err := matchParts(patternParts, splitPath(name))
+		if matched {
+			matches = append(matches, name)
+		}
+
+		return err
+	})
+
+	return matches, err
+}
+
+// GlobRoot is the directory the pattern's matches are all under, the
+// elements before the first one with a meta character.
+func GlobRoot(pattern string) string {
+	parts := splitPath(pattern)
+	idx := slices.IndexFunc(parts, IsGlob)
+	if idx < 0 {
+		return filepath.Dir(pattern)
+	}
+
+	root := strings.Join(parts[:idx], "/")
+	switch {
+	case root == "" && idx > 0:
+		return "/"
+	case root == "":
+		return "."
+	}
+
+	return filepath.FromSlash(root)
+}
+
+func matchParts(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(name); skip++ {
+				matched, err := matchParts(pattern[1:], name[skip:])
+				if err != nil || matched {
+					return matched, err
+				}
+			}
+
+			return false, nil
+		}
+
+		if len(name) == 0 {
+			return false, nil
+		}
+
+		matched, err := path.Match(pattern[0], name[0])
+		if err != nil || !matched {
+			return false, err
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0, nil
+}
+
+// WatchDirFor is the directory to watch to see the matches of pattern
+// come and go. A single (non-recursive) watch can't see all of the
+// matches of patterns like dir/*/file or dir/**/file.
+func WatchDirFor(pattern string) (string, error) {
+	dir := filepath.Dir(pattern)
+	if IsGlob(dir) || strings.Contains(pattern, "**") {
+		return "", fmt.Errorf("%s: %w", pattern, ErrWatchUnsupported)
+	}
+
+	return dir, nil
+}
+
+// GlobPollPolicy backs off for patterns with **, they can't be watched
+// and every check walks the whole tree under them, like dir-updated
+// --recursive without a watch.
+func GlobPollPolicy(pattern string) PollPolicy {
+	if !strings.Contains(pattern, "**") {
+		return PollPolicy{}
+	}
+
+	return PollPolicy{Interval: 2 * time.Second, MaxInterval: 10 * time.Second, BackoffFactor: 1.5}
+}
+
+func GlobDetails(matches []string) map[string]string {
+	return map[string]string{
+		"match_count":   strconv.Itoa(len(matches)),
+		"matched_paths": strings.Join(matches, "\n"),
+	}
+}
+
+// MatchesAnyPath reports whether name matches any of patterns, patterns
+// with a / are matched against the whole of name (and may use **), the
+// others only against its last element, eg: *.tmp or .git
+func MatchesAnyPath(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		var matched bool
+		if strings.Contains(filepath.ToSlash(pattern), "/") {
+			matched, _ = matchParts(splitPath(pattern), splitPath(name))
+		} else {
+			matched, _ = path.Match(pattern, filepath.Base(name))
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
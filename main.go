@@ -1,10 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"syscall"
+	"text/template"
 	"time"
+	"unicode"
 
 	"github.com/alecthomas/kong"
 	// "github.com/posener/complete"
@@ -14,6 +23,28 @@ import (
 type Condition interface {
 	Init(*Context) (Condition, error)
 	Check(*Context) (Condition, bool, error)
+	WaitingOn() WaitableThing
+	Target() string
+}
+
+// Conditions implement Detailer to report what they found (eg: which
+// children of a composite fired) to notifications.
+type Detailer interface {
+	Details() map[string]string
+}
+
+// Conditions implement Expecter when they can be met in a way that wasn't
+// hoped for (eg: a process exiting with the wrong code), the wait is then
+// reported as failed instead of succeeded.
+type Expecter interface {
+	Unexpected() error
+}
+
+// Wakers hand WaitForCondition channels that receive when the condition
+// may have become true (eg: a pidfd saying its process exited), so it can
+// be checked right away instead of after the poll interval.
+type Waker interface {
+	WakeOn() []<-chan struct{}
 }
 
 type Notification interface {
@@ -35,34 +66,67 @@ const (
 	WaitOnSocketConnect
 	WaitOnHttpHeadOk
 	WaitOnHttpsHeadOk
+	WaitOnSocketRefused
+	WaitOnCommandExit
+	WaitOnCommandSucceeds
+	WaitOnCommandFails
+	WaitOnAllOf
+	WaitOnAnyOf
+	WaitOnNOf
+	WaitOnFileContains
+	WaitOnFileStable
+	WaitOnProcExits
+	WaitOnProcStarted
 )
 
 var WaitableThingToStringTable = map[WaitableThing]string{
-	Invalid:             "Invalid",
-	WaitOnFileExists:    "WaitOnFileExists",
-	WaitOnFileRemoved:   "WaitOnFileRemoved",
-	WaitOnFileChanged:   "WaitOnFileChanged",
-	WaitOnDirExists:     "WaitOnDirExists",
-	WaitOnDirRemoved:    "WaitOnDirRemoved",
-	WaitOnDirChanged:    "WaitOnDirChanged",
-	WaitOnPidExit:       "WaitOnPidExit",
-	WaitOnSocketConnect: "WaitOnSocketConnect",
-	WaitOnHttpHeadOk:    "WaitOnHttpHeadOk",
-	WaitOnHttpsHeadOk:   "WaitOnHttpsHeadOk",
+	Invalid:               "Invalid",
+	WaitOnFileExists:      "WaitOnFileExists",
+	WaitOnFileRemoved:     "WaitOnFileRemoved",
+	WaitOnFileChanged:     "WaitOnFileChanged",
+	WaitOnDirExists:       "WaitOnDirExists",
+	WaitOnDirRemoved:      "WaitOnDirRemoved",
+	WaitOnDirChanged:      "WaitOnDirChanged",
+	WaitOnPidExit:         "WaitOnPidExit",
+	WaitOnSocketConnect:   "WaitOnSocketConnect",
+	WaitOnHttpHeadOk:      "WaitOnHttpHeadOk",
+	WaitOnHttpsHeadOk:     "WaitOnHttpsHeadOk",
+	WaitOnSocketRefused:   "WaitOnSocketRefused",
+	WaitOnCommandExit:     "WaitOnCommandExit",
+	WaitOnCommandSucceeds: "WaitOnCommandSucceeds",
+	WaitOnCommandFails:    "WaitOnCommandFails",
+	WaitOnAllOf:           "WaitOnAllOf",
+	WaitOnAnyOf:           "WaitOnAnyOf",
+	WaitOnNOf:             "WaitOnNOf",
+	WaitOnFileContains:    "WaitOnFileContains",
+	WaitOnFileStable:      "WaitOnFileStable",
+	WaitOnProcExits:       "WaitOnProcExits",
+	WaitOnProcStarted:     "WaitOnProcStarted",
 }
 
 var StringToWaitableThingTable = map[string]WaitableThing{
-	"Invalid":             Invalid,
-	"WaitOnFileExists":    WaitOnFileExists,
-	"WaitOnFileRemoved":   WaitOnFileRemoved,
-	"WaitOnFileChanged":   WaitOnFileChanged,
-	"WaitOnDirExists":     WaitOnDirExists,
-	"WaitOnDirRemoved":    WaitOnDirRemoved,
-	"WaitOnDirChanged":    WaitOnDirChanged,
-	"WaitOnPidExit":       WaitOnPidExit,
-	"WaitOnSocketConnect": WaitOnSocketConnect,
-	"WaitOnHttpHeadOk":    WaitOnHttpHeadOk,
-	"WaitOnHttpsHeadOk":   WaitOnHttpsHeadOk,
+	"Invalid":               Invalid,
+	"WaitOnFileExists":      WaitOnFileExists,
+	"WaitOnFileRemoved":     WaitOnFileRemoved,
+	"WaitOnFileChanged":     WaitOnFileChanged,
+	"WaitOnDirExists":       WaitOnDirExists,
+	"WaitOnDirRemoved":      WaitOnDirRemoved,
+	"WaitOnDirChanged":      WaitOnDirChanged,
+	"WaitOnPidExit":         WaitOnPidExit,
+	"WaitOnSocketConnect":   WaitOnSocketConnect,
+	"WaitOnHttpHeadOk":      WaitOnHttpHeadOk,
+	"WaitOnHttpsHeadOk":     WaitOnHttpsHeadOk,
+	"WaitOnSocketRefused":   WaitOnSocketRefused,
+	"WaitOnCommandExit":     WaitOnCommandExit,
+	"WaitOnCommandSucceeds": WaitOnCommandSucceeds,
+	"WaitOnCommandFails":    WaitOnCommandFails,
+	"WaitOnAllOf":           WaitOnAllOf,
+	"WaitOnAnyOf":           WaitOnAnyOf,
+	"WaitOnNOf":             WaitOnNOf,
+	"WaitOnFileContains":    WaitOnFileContains,
+	"WaitOnFileStable":      WaitOnFileStable,
+	"WaitOnProcExits":       WaitOnProcExits,
+	"WaitOnProcStarted":     WaitOnProcStarted,
 }
 
 func (self WaitableThing) String() string {
@@ -73,6 +137,10 @@ func StringToWaitableThing(str string) WaitableThing {
 	return StringToWaitableThingTable[str]
 }
 
+func Describe(condition Condition) string {
+	return fmt.Sprintf("%s %s", condition.WaitingOn(), condition.Target())
+}
+
 // //////////////////////////////////////
 type NotificationType int
 
@@ -104,100 +172,414 @@ func StringToNotificationType(str string) NotificationType {
 
 /******************************************************************************/
 type Context struct {
-	Verbose         bool
-	TellMeByRunning string
+	Verbose bool
+	// Ctx is cancelled with an InterruptedError on SIGINT or SIGTERM
+	Ctx context.Context
+	// Notifiers are sent the progress notifications and the success,
+	// SuccessNotifiers only the success, ErrorNotifiers only condition
+	// errors, TimeoutNotifiers only timeouts and FailureNotifiers errors,
+	// timeouts and unexpected exits, InterruptNotifiers only interrupts.
+	Notifiers          []Notification
+	SuccessNotifiers   []Notification
+	FailureNotifiers   []Notification
+	ErrorNotifiers     []Notification
+	TimeoutNotifiers   []Notification
+	InterruptNotifiers []Notification
+	NotifyEvery        time.Duration
+	Timeout            time.Duration
+	Deadline           time.Time
+	Poll               PollPolicy
+	MessageTemplate    *template.Template
+	Event              Event
 }
 
-func (self *Context) WaitSucceeded(condition Condition) {
-	if self.TellMeByRunning != "" {
-		cmd := exec.Command("bash", "-c", self.TellMeByRunning)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		err := cmd.Start()
-		if err != nil {
-			fmt.Printf("Context.WaitSucceeded: error executing --tellme-via-running='%s'; err=%v\n", self.TellMeByRunning, err)
-			panic(err)
-		}
+// Context is what conditions and notifications pass along to anything
+// that blocks (commands, dials, requests) so that it is stopped when the
+// wait is interrupted.
+func (self *Context) Context() context.Context {
+	if self.Ctx == nil {
+		return context.Background()
+	}
 
-		err = cmd.Wait()
-		if err != nil {
-			fmt.Printf(": error executing -tellme-via-running='%s'; err=%v\n", self.TellMeByRunning, err)
-			panic(err)
+	return self.Ctx
+}
+
+// DeadlineFrom returns the time at which a wait that started at start
+// should give up, the earlier of --timeout and --deadline, or the zero
+// time when the wait may run forever.
+func (self *Context) DeadlineFrom(start time.Time) time.Time {
+	deadline := self.Deadline
+	if self.Timeout > 0 {
+		timeoutAt := start.Add(self.Timeout)
+		if deadline.IsZero() || timeoutAt.Before(deadline) {
+			deadline = timeoutAt
 		}
 	}
+
+	return deadline
 }
 
 func (self *Context) Finalize(condition Condition) error {
-	if self.TellMeByRunning != "" {
-		cmd := exec.Command("bash", "-c", self.TellMeByRunning)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		err := cmd.Start()
-		if err != nil {
-			fmt.Printf("Context.Finalize: error executing -tellme-via-running='%s'; err=%v\n", self.TellMeByRunning, err)
-			return err
-		}
-
-		err = cmd.Wait()
-		if err != nil {
-			return err
-		}
+	self.Event.Update(condition, OutcomeSucceeded)
 
+	notifiers := slices.Concat(self.Notifiers, self.SuccessNotifiers)
+	if len(notifiers) == 0 {
+		fmt.Printf("\n%s\n", self.Event.Message())
 		return nil
 	}
 
-	return fmt.Errorf("Context.Finalize: error: don't know how to notify (no --notify-by-running passed?)")
+	err := NotifyAll(self, notifiers)
+	if err != nil {
+		return &NotifyError{Err: err}
+	}
+
+	return nil
+}
+
+// Unexpected reports a condition that was met, but not the way it was
+// expected to be, to the failure notifiers, err is still what's returned.
+func (self *Context) Unexpected(condition Condition, err error) error {
+	self.Event.Update(condition, OutcomeFailed)
+	self.Event.Error = err.Error()
+
+	notifyErr := NotifyAll(self, self.FailureNotifiers)
+	if notifyErr != nil {
+		fmt.Fprintf(os.Stderr, "Context.Unexpected: error notifying of the failure; err=%v\n", notifyErr)
+	}
+
+	return err
+}
+
+// Failed reports a condition that could not be initialized or checked
+// (an InitError or CheckError) to the error and failure notifiers, err
+// is still what's returned.
+func (self *Context) Failed(condition Condition, err error) error {
+	self.Event.Update(condition, OutcomeError)
+	self.Event.Error = err.Error()
+
+	notifyErr := NotifyAll(self, slices.Concat(self.ErrorNotifiers, self.FailureNotifiers))
+	if notifyErr != nil {
+		fmt.Fprintf(os.Stderr, "Context.Failed: error notifying of the failure; err=%v\n", notifyErr)
+	}
+
+	return err
+}
+
+// Progress sends a "still waiting" notification, failing to send one is
+// reported but does not end the wait.
+func (self *Context) Progress(condition Condition) {
+	self.Event.Update(condition, OutcomeWaiting)
+
+	if len(self.Notifiers) == 0 {
+		fmt.Printf("\n%s\n", self.Event.Message())
+		return
+	}
+
+	err := NotifyAll(self, self.Notifiers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Context.Progress: error sending progress notification; err=%v\n", err)
+	}
+}
+
+func (self *Context) TimedOut(condition Condition, deadline time.Time) error {
+	self.Event.Update(condition, OutcomeTimedOut)
+
+	timeoutErr := &TimeoutError{StartTime: self.Event.StartTime, Deadline: deadline}
+	err := NotifyAll(self, slices.Concat(self.TimeoutNotifiers, self.FailureNotifiers))
+	if err != nil {
+		// NB: the timeout is still what gets reported, the exit code
+		// should reflect that the wait gave up
+		fmt.Fprintf(os.Stderr, "Context.TimedOut: error notifying of the timeout; err=%v\n", err)
+	}
+
+	return timeoutErr
+}
+
+// Interrupted sends the interrupt notifications, they're sent with a
+// context of their own since the wait's has already been cancelled.
+func (self *Context) Interrupted(condition Condition) error {
+	self.Event.Update(condition, OutcomeInterrupted)
+	err := context.Cause(self.Context())
+
+	parent := self.Ctx
+	notifyCtx, cancel := context.WithTimeout(context.WithoutCancel(self.Context()), DefaultNotifyTimeout)
+	defer cancel()
+	self.Ctx = notifyCtx
+	notifyErr := NotifyAll(self, self.InterruptNotifiers)
+	self.Ctx = parent
+
+	if notifyErr != nil {
+		fmt.Fprintf(os.Stderr, "Context.Interrupted: error notifying of the interrupt; err=%v\n", notifyErr)
+	}
+
+	return err
+}
+
+// CutOff reports a wait that was cut off by cause, as timed out when it
+// was the deadline, as interrupted otherwise.
+func (self *Context) CutOff(condition Condition, deadline time.Time, cause error) error {
+	var timeoutErr *TimeoutError
+	if errors.As(cause, &timeoutErr) {
+		return self.TimedOut(condition, deadline)
+	}
+
+	return self.Interrupted(condition)
 }
 
 func (self *Context) WaitForCondition(condition Condition) error {
 	var err error
 	var res bool
+	start := time.Now()
+	deadline := self.DeadlineFrom(start)
+	self.Event = NewEvent(condition, start)
+	self.Event.MessageTemplate = self.MessageTemplate
+
+	// NB: the deadline has to reach the checks that block (eg: a probe
+	// command, an http request), not only the sleeps between them; the
+	// wait's own context is put back before the outcome is notified, so
+	// that the notifications aren't cut off by it too
+	parent := self.Ctx
+	defer func() { self.Ctx = parent }()
+	if !deadline.IsZero() {
+		deadlineCtx, cancel := context.WithDeadlineCause(self.Context(), deadline,
+			&TimeoutError{StartTime: start, Deadline: deadline})
+		defer cancel()
+		self.Ctx = deadlineCtx
+	}
+
+	cutOff := func() error {
+		cause := context.Cause(self.Context())
+		self.Ctx = parent
+		return self.CutOff(condition, deadline, cause)
+	}
+
 	condition, err = condition.Init(self)
+	if err != nil && self.Context().Err() != nil {
+		return cutOff()
+	}
+
 	if err != nil {
-		return err
+		self.Ctx = parent
+		return self.Failed(condition, &InitError{Description: Describe(condition), Err: err})
+	}
+
+	// NB: conditions that hold on to resources (pidfds, child processes)
+	// release them once the wait is over
+	defer func() {
+		if closer, ok := condition.(io.Closer); ok {
+			closer.Close()
+		}
+	}()
+
+	wakes := []<-chan struct{}{self.Context().Done()}
+	if waker, ok := condition.(Waker); ok {
+		wakes = append(wakes, waker.WakeOn()...)
+	}
+
+	policy := PollPolicyFor(self.Poll, condition)
+	if watchable, ok := condition.(Watchable); ok {
+		watch, err := NewFileWatch()
+		if err == nil {
+			defer watch.Close()
+			wakes = append(wakes, watch.Events())
+			condition, err = watchable.Watch(self, watch)
+		}
+
+		if err == nil {
+			policy = self.Poll.Merge(WatchedPollPolicy)
+		} else if self.Verbose {
+			fmt.Printf("WaitForCondition: polling, unable to watch %s; err=%v\n", Describe(condition), err)
+		}
+	}
+
+	poller := NewPoller(policy)
+	if self.Verbose {
+		fmt.Printf("WaitForCondition: poll policy=%+v\n", poller.Policy)
 	}
 
+	nextProgress := start.Add(self.NotifyEvery)
+
 	for {
 		condition, res, err = condition.Check(self)
+		if err != nil && self.Context().Err() != nil {
+			return cutOff()
+		}
+
 		if err != nil {
-			return err
+			self.Ctx = parent
+			return self.Failed(condition, &CheckError{Description: Describe(condition), Err: err})
 		}
 
 		if res {
+			self.Ctx = parent
+			if expecter, ok := condition.(Expecter); ok {
+				err = expecter.Unexpected()
+				if err != nil {
+					return self.Unexpected(condition, err)
+				}
+			}
+
 			return self.Finalize(condition)
 		}
 
-		time.Sleep(100 * time.Millisecond)
+		sleepFor := poller.Next()
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				self.Ctx = parent
+				return self.TimedOut(condition, deadline)
+			}
+
+			sleepFor = min(sleepFor, remaining)
+		}
+
+		if self.NotifyEvery > 0 {
+			if !time.Now().Before(nextProgress) {
+				self.Progress(condition)
+				for !time.Now().Before(nextProgress) {
+					nextProgress = nextProgress.Add(self.NotifyEvery)
+				}
+			}
+
+			sleepFor = min(sleepFor, time.Until(nextProgress))
+		}
+
+		SleepOrWake(sleepFor, wakes)
+		if self.Context().Err() != nil {
+			return cutOff()
+		}
+
 		fmt.Printf(".")
 	}
+}
 
-	return fmt.Errorf("WaitForCondition: terminated the for loop w/o succeeding or failing?")
+// SleepOrWake sleeps for sleepFor or until one of wakes receives.
+func SleepOrWake(sleepFor time.Duration, wakes []<-chan struct{}) {
+	timer := time.NewTimer(sleepFor)
+	defer timer.Stop()
+
+	cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer.C)}}
+	for _, wake := range wakes {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(wake)})
+	}
+
+	reflect.Select(cases)
+}
+
+// layouts accepted by --deadline, times without a zone are local
+var DeadlineLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+func ParseDeadline(str string) (time.Time, error) {
+	for _, layout := range DeadlineLayouts {
+		deadline, err := time.ParseInLocation(layout, str, time.Local)
+		if err == nil {
+			return deadline, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unable to parse --deadline='%s', expected a time like 2006-01-02T15:04 or RFC3339", str)
+}
+
+// ConditionCommand is implemented by the commands that wait on a
+// condition, it builds the condition from the command's flags.
+type ConditionCommand interface {
+	Condition() (Condition, error)
+}
+
+func (self *Context) WaitForCommand(command ConditionCommand) error {
+	condition, err := command.Condition()
+	if err != nil {
+		return &BadArgumentsError{Err: err}
+	}
+
+	return self.WaitForCondition(condition)
 }
 
 // //////////////////////////////////////////////////////////////////////////////
 // File Operations
 type FileExistsCmd struct {
-	FileName string `help:"the path to the file to look for creation of"`
+	FileName string `help:"the path to the file to look for creation of, or a glob (eg: out/**/part-*.parquet)"`
+	AtLeast  int    `default:"1" help:"with a glob, how many files have to match it"`
+}
+
+func (self *FileExistsCmd) Condition() (Condition, error) {
+	return FileExistsCondition{FileName: self.FileName, AtLeast: self.AtLeast}, ValidateGlob(self.FileName)
 }
 
 func (self *FileExistsCmd) Run(ctx *Context) error {
-	return ctx.WaitForCondition(FileExistsCondition{FileName: self.FileName})
+	return ctx.WaitForCommand(self)
 }
 
 type FileRemovedCmd struct {
-	FileName string `help:"the path to the file to watch for removal of"`
+	FileName string `help:"the path to the file to watch for removal of, or a glob (eg: locks/*.lock)"`
+	AtMost   int    `default:"0" help:"with a glob, how many files may still match it"`
+}
+
+func (self *FileRemovedCmd) Condition() (Condition, error) {
+	return FileRemovedCondition{FileName: self.FileName, AtMost: self.AtMost}, ValidateGlob(self.FileName)
 }
 
 func (self *FileRemovedCmd) Run(ctx *Context) error {
-	return ctx.WaitForCondition(FileRemovedCondition{FileName: self.FileName})
+	return ctx.WaitForCommand(self)
 }
 
 type FileUpdatedCmd struct {
-	FileName string `help:"the path to the file to watch for update of"`
+	FileName string   `help:"the path to the file to watch for update of"`
+	Detect   []string `default:"mtime" help:"what counts as an update: mtime, size or hash (sha256 of the contents), eg: --detect=size,hash fires when either changes"`
+}
+
+func (self *FileUpdatedCmd) Condition() (Condition, error) {
+	detect, err := ParseDetectMode(self.Detect)
+	if err != nil {
+		return nil, err
+	}
+
+	return FileUpdatedCondition{FileName: self.FileName, Detect: detect}, nil
 }
 
 func (self *FileUpdatedCmd) Run(ctx *Context) error {
-	return ctx.WaitForCondition(FileUpdatedCondition{FileName: self.FileName})
+	return ctx.WaitForCommand(self)
+}
+
+type FileContainsCmd struct {
+	FileName     string `required:"" help:"the path to the file to follow, like tail -F"`
+	Pattern      string `required:"" help:"the regular expression to wait for a line to match"`
+	ErrorPattern string `help:"a regular expression that fails the wait as soon as a line matches it"`
+	FromStart    bool   `help:"match the lines already in the file too, not only the ones added from now on"`
+	Count        int    `default:"1" help:"how many matching lines to wait for"`
+}
+
+func (self *FileContainsCmd) Condition() (Condition, error) {
+	return NewFileContainsCondition(self.FileName, self.Pattern, self.ErrorPattern, self.FromStart, self.Count)
+}
+
+func (self *FileContainsCmd) Run(ctx *Context) error {
+	return ctx.WaitForCommand(self)
+}
+
+type FileStableCmd struct {
+	FileName string        `required:"" help:"the path to the file to wait on to stop changing"`
+	QuietFor time.Duration `required:"" help:"how long the file's size and mtime have to stay the same (eg: 30s)"`
+	Hash     bool          `help:"also require the file's contents (sha256) to stay the same"`
+	MinSize  int64         `help:"the size in bytes the file has to have grown to"`
+}
+
+func (self *FileStableCmd) Condition() (Condition, error) {
+	if self.QuietFor <= 0 {
+		return nil, fmt.Errorf("--quiet-for must be positive, got %s", self.QuietFor)
+	}
+
+	return FileStableCondition{FileName: self.FileName, QuietFor: self.QuietFor, Hash: self.Hash, MinSize: self.MinSize}, nil
+}
+
+func (self *FileStableCmd) Run(ctx *Context) error {
+	return ctx.WaitForCommand(self)
 }
 
 // Directory Operations
@@ -205,92 +587,583 @@ type DirExistsCmd struct {
 	DirName string `help:"the path to the dir to look for creation of"`
 }
 
+func (self *DirExistsCmd) Condition() (Condition, error) {
+	return DirExistsCondition{DirName: self.DirName}, nil
+}
+
 func (self *DirExistsCmd) Run(ctx *Context) error {
-	return ctx.WaitForCondition(DirExistsCondition{DirName: self.DirName})
+	return ctx.WaitForCommand(self)
 }
 
 type DirRemovedCmd struct {
 	DirName string `help:"the path to the dir to watch for removal of"`
 }
 
+func (self *DirRemovedCmd) Condition() (Condition, error) {
+	return DirRemovedCondition{DirName: self.DirName}, nil
+}
+
 func (self *DirRemovedCmd) Run(ctx *Context) error {
-	return ctx.WaitForCondition(DirRemovedCondition{DirName: self.DirName})
+	return ctx.WaitForCommand(self)
 }
 
 type DirUpdatedCmd struct {
-	DirName string `help:"the path to the dir to watch for update of"`
+	DirName   string   `help:"the path to the dir to watch for update of"`
+	Recursive bool     `help:"watch the whole tree for files being added, removed, modified or renamed"`
+	Include   []string `help:"with --recursive only report files matching this glob, eg: *.go or src/**/*.c (repeatable)"`
+	Exclude   []string `help:"with --recursive ignore paths matching this glob, eg: .git or *.tmp (repeatable)"`
+}
+
+func (self *DirUpdatedCmd) Condition() (Condition, error) {
+	if !self.Recursive && (len(self.Include) > 0 || len(self.Exclude) > 0) {
+		return nil, fmt.Errorf("--include and --exclude require --recursive")
+	}
+
+	for _, pattern := range slices.Concat(self.Include, self.Exclude) {
+		err := ValidateGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return DirUpdatedCondition{DirName: self.DirName, Recursive: self.Recursive, Include: self.Include, Exclude: self.Exclude}, nil
 }
 
 func (self *DirUpdatedCmd) Run(ctx *Context) error {
-	return ctx.WaitForCondition(DirUpdatedCondition{DirName: self.DirName})
+	return ctx.WaitForCommand(self)
 }
 
 // Process Operations
 type ProcessExitsCmd struct {
-	CommandStr string `required:"" name:"command" help:"the command to execute and wait until it terminates"`
+	CommandStr   string   `required:"" name:"command" help:"the command to execute and wait until it terminates"`
+	TailLines    int      `name:"tail-lines" default:"20" help:"how many of the last lines of output to pass along to the notifications"`
+	ExpectExit   []string `name:"expect-exit" help:"the exit code(s) hoped for, eg: 0 or 1-125, any other ending is reported as a failure"`
+	ExpectSignal []string `name:"expect-signal" help:"the signal(s) the command is hoped to be killed by, eg: SIGKILL"`
+	Tree         bool     `help:"also wait for every process the command started to exit, even ones that daemonized (linux only)"`
+}
+
+func (self *ProcessExitsCmd) Condition() (Condition, error) {
+	expect, err := ParseExitExpectation(self.ExpectExit, self.ExpectSignal)
+	if err != nil {
+		return nil, err
+	}
+
+	return CommandExitedCondition{CommandStr: self.CommandStr, TailLines: self.TailLines, Expect: expect, Tree: self.Tree}, nil
 }
 
 func (self *ProcessExitsCmd) Run(ctx *Context) error {
-	return ctx.WaitForCondition(CommandExitedCondition{CommandStr: self.CommandStr})
+	return ctx.WaitForCommand(self)
 }
 
 type ProcessSucceedsCmd struct {
-	Command string `help:"the command to execute until it succeeds (exit 0), via bash -c '<command>'."`
+	Command        string        `help:"the command to execute until it succeeds (exit 0), via bash -c '<command>'."`
+	MaxAttempts    int           `name:"max-attempts" help:"fail the wait after this many unsuccessful attempts (default: keep trying)"`
+	AttemptTimeout time.Duration `name:"attempt-timeout" help:"give up on an attempt that takes longer than this (eg: 30s), it counts as a failure"`
+	Quiet          bool          `help:"don't pass along the command's output, the tail of the last failure is still in the notifications"`
+	TailLines      int           `name:"tail-lines" default:"20" help:"how many of the last lines of output of the last failed attempt to pass along to the notifications"`
+}
+
+func (self *ProcessSucceedsCmd) Condition() (Condition, error) {
+	if self.MaxAttempts < 0 || self.AttemptTimeout < 0 {
+		return nil, fmt.Errorf("--max-attempts and --attempt-timeout must not be negative")
+	}
+
+	return CommandSucceedsCondition{
+		CommandStr:     self.Command,
+		MaxAttempts:    self.MaxAttempts,
+		AttemptTimeout: self.AttemptTimeout,
+		Quiet:          self.Quiet,
+		TailLines:      self.TailLines,
+	}, nil
 }
 
 func (self *ProcessSucceedsCmd) Run(ctx *Context) error {
-	return ctx.WaitForCondition(CommandSucceedsCondition{CommandStr: self.Command})
+	return ctx.WaitForCommand(self)
 }
 
 type ProcessFailsCmd struct {
-	Command string `help:"the command to execute until it fails (exit non zero), via bash -c '<command>'."`
+	Command        string        `help:"the command to execute until it fails (exit non zero), via bash -c '<command>'."`
+	ExitCode       *int          `name:"exit-code" help:"only this exit code counts as a failure, eg: 2"`
+	Consecutive    int           `name:"consecutive" default:"1" help:"how many failures in a row to wait for"`
+	AttemptTimeout time.Duration `name:"attempt-timeout" help:"give up on a run that takes longer than this (eg: 30s), it counts as a failure"`
+	Quiet          bool          `help:"don't pass along the command's output, the tail of the last run is still in the notifications"`
+	TailLines      int           `name:"tail-lines" default:"20" help:"how many of the last lines of output of the last run to pass along to the notifications"`
+}
+
+func (self *ProcessFailsCmd) Condition() (Condition, error) {
+	if self.Consecutive < 1 || self.AttemptTimeout < 0 {
+		return nil, fmt.Errorf("--consecutive must be at least 1 and --attempt-timeout must not be negative")
+	}
+
+	return CommandFailsCondition{
+		CommandStr:     self.Command,
+		ExitCode:       self.ExitCode,
+		Consecutive:    self.Consecutive,
+		AttemptTimeout: self.AttemptTimeout,
+		Quiet:          self.Quiet,
+		TailLines:      self.TailLines,
+	}, nil
 }
 
 func (self *ProcessFailsCmd) Run(ctx *Context) error {
-	return ctx.WaitForCondition(CommandFailsCondition{CommandStr: self.Command})
+	return ctx.WaitForCommand(self)
+}
+
+// ProcMatchFlags pick processes out like pgrep does, they're shared by
+// proc-exits and proc-started.
+type ProcMatchFlags struct {
+	Match  string `help:"a regular expression to match against the process name (eg: ^postgres$)"`
+	Full   bool   `help:"match --match against the whole command line instead of the name, like pgrep -f"`
+	User   string `help:"only processes run by this user (a name or uid)"`
+	Parent int    `help:"only processes whose parent is this pid"`
+}
+
+func (self ProcMatchFlags) Matcher() (ProcMatcher, error) {
+	return NewProcMatcher(self.Match, self.Full, self.User, self.Parent)
+}
+
+type ProcExitsCmd struct {
+	ProcMatchFlags `embed:""`
+	Any            bool `help:"notify when any of the matching processes exits, instead of all of them"`
+}
+
+func (self *ProcExitsCmd) Condition() (Condition, error) {
+	matcher, err := self.Matcher()
+	if err != nil {
+		return nil, err
+	}
+
+	return ProcExitedCondition{Matcher: matcher, Any: self.Any}, nil
+}
+
+func (self *ProcExitsCmd) Run(ctx *Context) error {
+	return ctx.WaitForCommand(self)
+}
+
+type ProcStartedCmd struct {
+	ProcMatchFlags `embed:""`
+	NewOnly        bool `name:"new-only" help:"ignore matching processes that are already running"`
+}
+
+func (self *ProcStartedCmd) Condition() (Condition, error) {
+	matcher, err := self.Matcher()
+	if err != nil {
+		return nil, err
+	}
+
+	return ProcStartedCondition{Matcher: matcher, NewOnly: self.NewOnly}, nil
+}
+
+func (self *ProcStartedCmd) Run(ctx *Context) error {
+	return ctx.WaitForCommand(self)
 }
 
 type PidExitsCmd struct {
-	Pid int `name:"pid" required:"" help:"the pid of the process to wait to terminate."`
+	Pid          int      `name:"pid" required:"" help:"the pid of the process to wait to terminate."`
+	ExpectExit   []string `name:"expect-exit" help:"the exit code(s) hoped for, eg: 0 or 1-125, any other ending is reported as a failure"`
+	ExpectSignal []string `name:"expect-signal" help:"the signal(s) the process is hoped to be killed by, eg: SIGKILL"`
+	Tree         bool     `help:"also wait for every process it started (found through /proc) to exit (linux only)"`
+}
+
+func (self *PidExitsCmd) Condition() (Condition, error) {
+	expect, err := ParseExitExpectation(self.ExpectExit, self.ExpectSignal)
+	if err != nil {
+		return nil, err
+	}
+
+	return PidExitedCondition{Pid: self.Pid, Expect: expect, Tree: self.Tree}, nil
 }
 
 func (self *PidExitsCmd) Run(ctx *Context) error {
-	return ctx.WaitForCondition(PidExitedCondition{Pid: self.Pid})
+	return ctx.WaitForCommand(self)
 }
 
-/******************************************************************************/
-var CommandLine struct {
-	Verbose         bool   `name:"verbose" optional:"" help:"Be verbose"`
-	TellMeByRunning string `name:"notify-by-running" help:"Command to execute to notify of completion."`
+// Network Operations
+type HttpOkCmd struct {
+	Url          string            `name:"url" required:"" help:"the http or https url to request."`
+	Method       string            `name:"method" enum:"HEAD,GET" default:"HEAD" help:"the http method to use (HEAD or GET)."`
+	AcceptStatus []int             `name:"status" default:"200" help:"the response status codes that satisfy the wait, may be repeated or comma separated."`
+	Headers      map[string]string `name:"header" help:"extra request headers as Name=Value, may be repeated."`
+	Insecure     bool              `name:"insecure" help:"skip TLS certificate verification."`
+}
+
+func (self *HttpOkCmd) Condition() (Condition, error) {
+	return HttpOkCondition{
+		Url:          self.Url,
+		Method:       self.Method,
+		AcceptStatus: self.AcceptStatus,
+		Headers:      self.Headers,
+		Insecure:     self.Insecure,
+	}, nil
+}
+
+func (self *HttpOkCmd) Run(ctx *Context) error {
+	return ctx.WaitForCommand(self)
+}
+
+type SocketConnectCmd struct {
+	Address     string        `name:"address" required:"" help:"the host:port (or socket path for unix) to connect to."`
+	Network     string        `name:"network" enum:"tcp,tcp4,tcp6,unix" default:"tcp" help:"the type of socket: tcp, tcp4, tcp6 or unix."`
+	DialTimeout time.Duration `name:"dial-timeout" default:"2s" help:"how long each connection attempt may take."`
+}
+
+func (self *SocketConnectCmd) Condition() (Condition, error) {
+	return SocketConnectCondition{Network: self.Network, Address: self.Address, DialTimeout: self.DialTimeout}, nil
+}
 
+func (self *SocketConnectCmd) Run(ctx *Context) error {
+	return ctx.WaitForCommand(self)
+}
+
+type SocketRefusedCmd struct {
+	Address     string        `name:"address" required:"" help:"the host:port (or socket path for unix) to connect to."`
+	Network     string        `name:"network" enum:"tcp,tcp4,tcp6,unix" default:"tcp" help:"the type of socket: tcp, tcp4, tcp6 or unix."`
+	DialTimeout time.Duration `name:"dial-timeout" default:"2s" help:"how long each connection attempt may take."`
+}
+
+func (self *SocketRefusedCmd) Condition() (Condition, error) {
+	return SocketRefusedCondition{Network: self.Network, Address: self.Address, DialTimeout: self.DialTimeout}, nil
+}
+
+func (self *SocketRefusedCmd) Run(ctx *Context) error {
+	return ctx.WaitForCommand(self)
+}
+
+// Composite Operations
+type CompositeCmd struct {
+	When []string `name:"when" sep:"none" required:"" help:"a condition to wait on, written as a command, eg: --when='file-exists --file-name=./done', may be repeated."`
+}
+
+func (self *CompositeCmd) Children() ([]Condition, error) {
+	var children []Condition
+	for _, spec := range self.When {
+		child, err := ParseConditionSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		children = append(children, child)
+	}
+
+	return children, nil
+}
+
+type AllOfCmd struct {
+	CompositeCmd
+}
+
+func (self *AllOfCmd) Condition() (Condition, error) {
+	children, err := self.Children()
+	return CompositeCondition{Mode: CompositeAllOf, Children: children}, err
+}
+
+func (self *AllOfCmd) Run(ctx *Context) error {
+	return ctx.WaitForCommand(self)
+}
+
+type AnyOfCmd struct {
+	CompositeCmd
+}
+
+func (self *AnyOfCmd) Condition() (Condition, error) {
+	children, err := self.Children()
+	return CompositeCondition{Mode: CompositeAnyOf, Children: children}, err
+}
+
+func (self *AnyOfCmd) Run(ctx *Context) error {
+	return ctx.WaitForCommand(self)
+}
+
+type NOfCmd struct {
+	CompositeCmd
+	Need int `name:"need" required:"" help:"how many of the --when conditions have to be met."`
+}
+
+func (self *NOfCmd) Condition() (Condition, error) {
+	children, err := self.Children()
+	if err != nil {
+		return nil, err
+	}
+
+	// NB: like the config's Need, a --need that can never be met is a bad
+	// argument rather than something for Init to find
+	if self.Need < 1 || self.Need > len(children) {
+		return nil, fmt.Errorf("--need=%d has to be from 1 to the number of --when conditions (%d)", self.Need, len(children))
+	}
+
+	return CompositeCondition{Mode: CompositeNOf, Need: self.Need, Children: children}, nil
+}
+
+func (self *NOfCmd) Run(ctx *Context) error {
+	return ctx.WaitForCommand(self)
+}
+
+// ParseConditionSpec builds the condition for a --when spec by parsing it
+// the same way the command line is parsed.
+func ParseConditionSpec(spec string) (Condition, error) {
+	args, err := SplitSpec(spec)
+	if err != nil {
+		return nil, fmt.Errorf("--when='%s': %w", spec, err)
+	}
+
+	var commands ConditionCommands
+	parser, err := kong.New(&commands, kong.Name("--when"))
+	if err != nil {
+		return nil, err
+	}
+
+	kctx, err := parser.Parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("--when='%s': %w", spec, err)
+	}
+
+	command, ok := kctx.Selected().Target.Addr().Interface().(ConditionCommand)
+	if !ok {
+		return nil, fmt.Errorf("--when='%s': '%s' does not wait on a condition", spec, kctx.Command())
+	}
+
+	return command.Condition()
+}
+
+// SplitSpec splits a --when spec into arguments like a (very) simple
+// shell: whitespace separates arguments, single and double quotes group
+// them and a backslash escapes the next character.
+func SplitSpec(spec string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	quote := rune(0)
+	escaped := false
+	for _, ch := range spec {
+		switch {
+		case escaped:
+			arg.WriteRune(ch)
+			escaped = false
+		case ch == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(ch)
+		case ch == '\'' || ch == '"':
+			quote = ch
+			inArg = true
+		case unicode.IsSpace(ch):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(ch)
+			inArg = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape")
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
+
+// Config File
+type ConfigCmd struct{}
+
+func (self *ConfigCmd) Run(ctx *Context) error {
+	if CommandLine.Config == "" {
+		return &BadArgumentsError{Err: fmt.Errorf("nothing to wait on: pass a command (see --help) or --config=<file.json>")}
+	}
+
+	config, err := LoadConfig(CommandLine.Config)
+	if err != nil {
+		return &BadArgumentsError{Err: err}
+	}
+
+	condition, err := config.Condition()
+	if err != nil {
+		return &BadArgumentsError{Err: err}
+	}
+
+	err = config.Apply(ctx)
+	if err != nil {
+		return &BadArgumentsError{Err: err}
+	}
+
+	return ctx.WaitForCondition(condition)
+}
+
+/******************************************************************************/
+// ConditionCommands are the commands that wait on a condition, they are
+// also what --when specs are parsed as.
+type ConditionCommands struct {
 	PidExits        PidExitsCmd        `cmd:"" name:"pid-exits" optional:"" help:"Notfiy when a pid has exited (return of exit code success/fail)"`
 	ProcessExits    ProcessExitsCmd    `cmd:"" name:"process-exits" optional:"" help:"Notify when a process exits (regardless of exit code sucess/fail)"`
 	ProcessSucceeds ProcessSucceedsCmd `cmd:"" name:"process-succeeds" optional:"" help:"Notify when a process succeeds"`
 	ProcessFails    ProcessFailsCmd    `cmd:"" name:"process-fails" optional:"" help:"Notify when a process fails"`
+	ProcExits       ProcExitsCmd       `cmd:"" name:"proc-exits" optional:"" help:"Notify when the processes matching a pattern have exited."`
+	ProcStarted     ProcStartedCmd     `cmd:"" name:"proc-started" optional:"" help:"Notify when a process matching a pattern is running."`
 
 	DirUpdated DirUpdatedCmd `cmd:"" name:"dir-updated" optional:"" help:"Notify when a directory has changed."`
 	DirExists  DirExistsCmd  `cmd:"" name:"dir-exists" optional:"" help:"Notify when a directory was created."`
 	DirRemoved DirRemovedCmd `cmd:"" name:"dir-removed" optional:"" help:"Notify when a directory was removed."`
 
-	FileUpdated FileUpdatedCmd `cmd:"" name:"file-updated" optional:"" help:"Notify when a fileectory has changed."`
-	FileExists  FileExistsCmd  `cmd:"" name:"file-exists" optional:"" help:"Notify when a fileectory was created."`
-	FileRemoved FileRemovedCmd `cmd:"" name:"file-removed" optional:"" help:"Notify when a fileectory was removed."`
+	FileUpdated  FileUpdatedCmd  `cmd:"" name:"file-updated" optional:"" help:"Notify when a fileectory has changed."`
+	FileExists   FileExistsCmd   `cmd:"" name:"file-exists" optional:"" help:"Notify when a fileectory was created."`
+	FileRemoved  FileRemovedCmd  `cmd:"" name:"file-removed" optional:"" help:"Notify when a fileectory was removed."`
+	FileContains FileContainsCmd `cmd:"" name:"file-contains" optional:"" help:"Notify when a line matching a regular expression is written to a file."`
+	FileStable   FileStableCmd   `cmd:"" name:"file-stable" optional:"" help:"Notify when a file has stopped changing."`
+
+	HttpOk        HttpOkCmd        `cmd:"" name:"http-ok" optional:"" aliases:"http-head-ok,https-head-ok" help:"Notify when an http or https url responds with an accepted status."`
+	SocketConnect SocketConnectCmd `cmd:"" name:"socket-connect" optional:"" help:"Notify when a socket accepts connections."`
+	SocketRefused SocketRefusedCmd `cmd:"" name:"socket-refused" optional:"" help:"Notify when a socket stops accepting connections."`
 
-	// TODO: SocketConnectCondition
-	// TODO: HttpHeadOkCondition
-	// TODO: HttpsHeadOkCondition
+	AllOf AllOfCmd `cmd:"" name:"all-of" optional:"" help:"Notify when all of the --when conditions are met."`
+	AnyOf AnyOfCmd `cmd:"" name:"any-of" optional:"" help:"Notify when any of the --when conditions is met."`
+	NOf   NOfCmd   `cmd:"" name:"n-of" optional:"" help:"Notify when at least --need of the --when conditions are met."`
+}
+
+var CommandLine struct {
+	Verbose         bool          `name:"verbose" optional:"" help:"Be verbose"`
+	Config          string        `name:"config" type:"existingfile" help:"Read what to wait on and how to notify from a json file (see sample-config.json)."`
+	TellMeByRunning []string      `name:"notify-by-running" sep:"none" help:"Command to execute to notify of completion, may be repeated."`
+	NotifyUrl       []string      `name:"notify-url" sep:"none" help:"Url to request to notify of completion, may be repeated."`
+	NotifyUrlMethod string        `name:"notify-url-method" enum:"GET,POST" default:"POST" help:"How to request --notify-url and the --on-*-url urls: GET, or POST a json description of the wait."`
+	NotifyUrlBody   string        `name:"notify-url-body" help:"Template for the body to POST to --notify-url and the --on-*-url urls instead of the json description of the wait."`
+	Message         string        `name:"message" help:"Template for the message every notifier is given (as {{.Message}} and TMW_MESSAGE)."`
+	NotifyEvery     time.Duration `name:"notify-every" help:"While still waiting, send a progress notification this often (eg: 30m)."`
+	OnSuccess       []string      `name:"on-success" sep:"none" help:"Command to execute to notify that the condition was met, may be repeated."`
+	OnFailure       []string      `name:"on-failure" sep:"none" help:"Command to execute to notify that the wait failed (an error, a timeout or an unexpected exit status), may be repeated."`
+	OnError         []string      `name:"on-error" sep:"none" help:"Command to execute to notify that the condition could not be checked, may be repeated."`
+	OnTimeoutRun    []string      `name:"on-timeout-run" sep:"none" help:"Command to execute to notify that the wait timed out, may be repeated."`
+	OnInterrupt     []string      `name:"on-interrupt" sep:"none" help:"Command to execute to notify that the wait was interrupted (SIGINT or SIGTERM), may be repeated."`
+	OnSuccessUrl    []string      `name:"on-success-url" sep:"none" help:"Url to request (like --notify-url) to notify that the condition was met, may be repeated."`
+	OnFailureUrl    []string      `name:"on-failure-url" sep:"none" help:"Url to request (like --notify-url) to notify that the wait failed, may be repeated."`
+	OnErrorUrl      []string      `name:"on-error-url" sep:"none" help:"Url to request (like --notify-url) to notify that the condition could not be checked, may be repeated."`
+	OnTimeoutUrl    []string      `name:"on-timeout-url" sep:"none" help:"Url to request (like --notify-url) to notify that the wait timed out, may be repeated."`
+	OnInterruptUrl  []string      `name:"on-interrupt-url" sep:"none" help:"Url to request (like --notify-url) to notify that the wait was interrupted, may be repeated."`
+	Timeout         time.Duration `name:"timeout" help:"Give up waiting after this long (eg: 90s, 10m, 2h)."`
+	Deadline        string        `name:"deadline" help:"Give up waiting at this local time (eg: 2026-10-18T09:00)."`
+	Interval        time.Duration `name:"interval" help:"How long to wait between checks (default: chosen per condition, 100ms for file checks)."`
+	MaxInterval     time.Duration `name:"max-interval" help:"The longest the interval may grow to when backing off."`
+	BackoffFactor   float64       `name:"backoff-factor" help:"Multiply the interval by this after each check (eg: 1.5), 1.0 disables backoff."`
+	Jitter          float64       `name:"jitter" help:"Randomize each interval by up to this fraction (eg: 0.1 for +/-10%)."`
+
+	ConfigFile ConfigCmd `cmd:"" name:"config" default:"1" hidden:"" help:"Wait on the condition described by --config."`
+
+	ConditionCommands `embed:""`
 }
 
 func main() {
-	ctx := kong.Parse(&CommandLine)
-	err := ctx.Run(&Context{Verbose: CommandLine.Verbose, TellMeByRunning: CommandLine.TellMeByRunning})
+	// NB: kong exits with 1 for bad arguments, which is what a failed
+	// condition check exits with
+	ctx := kong.Parse(&CommandLine, kong.Exit(func(code int) {
+		if code != ExitSuccess {
+			code = ExitBadArguments
+		}
 
-	// NB: a method of notificaiton is required
-	// --notify-by-running=<CMD> is required
+		os.Exit(code)
+	}))
+	if CommandLine.Config != "" && ctx.Command() != "config" {
+		ctx.Fatalf("--config can not be combined with the '%s' command", ctx.Command())
+	}
 
-	if err != nil {
-		panic(fmt.Errorf("Execution Error: %w", err))
+	waitCtx := &Context{
+		Verbose:     CommandLine.Verbose,
+		NotifyEvery: CommandLine.NotifyEvery,
+		Timeout:     CommandLine.Timeout,
+		Poll: PollPolicy{
+			Interval:      CommandLine.Interval,
+			MaxInterval:   CommandLine.MaxInterval,
+			BackoffFactor: CommandLine.BackoffFactor,
+			Jitter:        CommandLine.Jitter,
+		},
+	}
+	ctx.FatalIfErrorf(waitCtx.Poll.Validate())
+
+	if CommandLine.Message != "" {
+		tmpl, err := ParseTemplate("message", CommandLine.Message)
+		ctx.FatalIfErrorf(err)
+		waitCtx.MessageTemplate = tmpl
+	}
+
+	var err error
+	waitCtx.Notifiers, err = CommandNotifications(CommandLine.TellMeByRunning)
+	ctx.FatalIfErrorf(err)
+	waitCtx.SuccessNotifiers, err = CommandNotifications(CommandLine.OnSuccess)
+	ctx.FatalIfErrorf(err)
+	waitCtx.FailureNotifiers, err = CommandNotifications(CommandLine.OnFailure)
+	ctx.FatalIfErrorf(err)
+	waitCtx.ErrorNotifiers, err = CommandNotifications(CommandLine.OnError)
+	ctx.FatalIfErrorf(err)
+	waitCtx.TimeoutNotifiers, err = CommandNotifications(CommandLine.OnTimeoutRun)
+	ctx.FatalIfErrorf(err)
+	waitCtx.InterruptNotifiers, err = CommandNotifications(CommandLine.OnInterrupt)
+	ctx.FatalIfErrorf(err)
+
+	urlNotificationType := NotificationType(NotifyViaHttpPost)
+	if CommandLine.NotifyUrlMethod == "GET" {
+		urlNotificationType = NotifyViaHttpGet
+	}
+
+	if CommandLine.NotifyUrlBody != "" {
+		if urlNotificationType != NotifyViaHttpPost {
+			ctx.Fatalf("--notify-url-body requires --notify-url-method=POST")
+		}
+
+		_, err := ParseTemplate("notify-url-body", CommandLine.NotifyUrlBody)
+		ctx.FatalIfErrorf(err)
+	}
+
+	// NB: the --on-*-url flags are requested the same way as --notify-url
+	urlNotifiers := []struct {
+		notifiers *[]Notification
+		urls      []string
+	}{
+		{&waitCtx.Notifiers, CommandLine.NotifyUrl},
+		{&waitCtx.SuccessNotifiers, CommandLine.OnSuccessUrl},
+		{&waitCtx.FailureNotifiers, CommandLine.OnFailureUrl},
+		{&waitCtx.ErrorNotifiers, CommandLine.OnErrorUrl},
+		{&waitCtx.TimeoutNotifiers, CommandLine.OnTimeoutUrl},
+		{&waitCtx.InterruptNotifiers, CommandLine.OnInterruptUrl},
+	}
+	for _, urlNotifier := range urlNotifiers {
+		notifications, err := UrlNotifications(urlNotifier.urls, urlNotificationType, CommandLine.NotifyUrlBody)
+		ctx.FatalIfErrorf(err)
+		*urlNotifier.notifiers = append(*urlNotifier.notifiers, notifications...)
+	}
+
+	if CommandLine.Deadline != "" {
+		deadline, err := ParseDeadline(CommandLine.Deadline)
+		ctx.FatalIfErrorf(err)
+		waitCtx.Deadline = deadline
+	}
+
+	// NB: the first SIGINT or SIGTERM stops the wait (forwarding the
+	// signal to any commands we started), a second one kills tellmewhen
+	interruptCtx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		cancel(&InterruptedError{Signal: sig})
+	}()
+	waitCtx.Ctx = interruptCtx
+
+	err = ctx.Run(waitCtx)
+
+	if err != nil && CommandLine.Verbose {
+		fmt.Fprintf(os.Stderr, "\nExecution Error: %v\n(exit code %d)\n", err, ExitCodeForError(err))
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "\nExecution Error: %s\n", ErrorSummary(err))
 	}
 
-	os.Exit(0)
+	os.Exit(ExitCodeForError(err))
 }
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -413,3 +422,2130 @@ func TestSocketConnectCondition(t *testing.T) {
 		t.Fatalf("Error: expected socket connection Check to succeed, it failed? res=%t", res)
 	}
 }
+
+func TestSocketRefusedCondition(t *testing.T) {
+	var err error
+	var res bool
+	var condition Condition
+	ctx := &Context{}
+	socketPath := "./testing/tmp/TestSocketRefusedCondition.sock"
+
+	err = SetupEnsureFileDoesNotExist(t, socketPath)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure socket does not exist: socketPath=%s; err=%v", socketPath, err)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Error: unable to create listening unix socket: socketPath=%s; err=%v", socketPath, err)
+	}
+
+	condition = SocketConnectCondition{Network: "unix", Address: socketPath, DialTimeout: time.Second}
+	_, res, err = condition.Check(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+	}
+
+	if !res {
+		t.Fatalf("Error: expected socket connection Check to succeed, it failed? socketPath=%s", socketPath)
+	}
+
+	condition = SocketRefusedCondition{Network: "unix", Address: socketPath, DialTimeout: time.Second}
+	condition, res, err = condition.Check(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+	}
+
+	if res {
+		t.Fatalf("Error: expected condition.Check() to be false! (socketPath=%s is listening)", socketPath)
+	}
+
+	// NB: closing a unix listener also removes the socket file
+	listener.Close()
+
+	condition, res, err = condition.Check(ctx) // nolint: staticcheck
+	if err != nil {
+		t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+	}
+
+	if !res {
+		t.Fatalf("Error: expected condition.Check() to be true! (socketPath=%s was closed)", socketPath)
+	}
+}
+
+func TestHttpOkCondition(t *testing.T) {
+	var err error
+	var res bool
+	var condition Condition
+	ctx := &Context{}
+	ready := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Tellmewhen") != "test" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	condition = HttpOkCondition{Url: server.URL, Method: http.MethodGet, Headers: map[string]string{"X-Tellmewhen": "test"}}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init HttpOkCondition; err=%v", err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+	}
+
+	if res {
+		t.Fatalf("Error: expected condition.Check() to be false! (server is not ready)")
+	}
+
+	ready = true
+	condition, res, err = condition.Check(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+	}
+
+	if !res {
+		t.Fatalf("Error: expected condition.Check() to be true! (server is ready)")
+	}
+
+	if condition.(HttpOkCondition).StatusCode != http.StatusOK {
+		t.Fatalf("Error: expected StatusCode=%d, got %d", http.StatusOK, condition.(HttpOkCondition).StatusCode)
+	}
+}
+
+func TestHttpOkConditionAcceptStatus(t *testing.T) {
+	var err error
+	var res bool
+	var condition Condition
+	ctx := &Context{}
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+
+	condition = HttpOkCondition{Url: url, AcceptStatus: []int{http.StatusNotFound}}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init HttpOkCondition; err=%v", err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+	}
+
+	if !res {
+		t.Fatalf("Error: expected condition.Check() to be true! (404 is an accepted status)")
+	}
+
+	// once the server is gone the connection is refused, which is not an error
+	server.Close()
+	condition = HttpOkCondition{Url: url}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init HttpOkCondition; err=%v", err)
+	}
+
+	_, res, err = condition.Check(ctx)
+	if err != nil {
+		t.Fatalf("Error: expected connection refused to not be an error, err=%v", err)
+	}
+
+	if res {
+		t.Fatalf("Error: expected condition.Check() to be false! (server is closed)")
+	}
+}
+
+func TestHttpsOkConditionInsecure(t *testing.T) {
+	var err error
+	var res bool
+	var condition Condition
+	ctx := &Context{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// the test server's certificate is self signed, so verification fails
+	condition = HttpOkCondition{Url: server.URL}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init HttpOkCondition; err=%v", err)
+	}
+
+	_, res, err = condition.Check(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+	}
+
+	if res {
+		t.Fatalf("Error: expected condition.Check() to be false! (certificate is not trusted)")
+	}
+
+	condition = HttpOkCondition{Url: server.URL, Insecure: true}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init HttpOkCondition; err=%v", err)
+	}
+
+	_, res, err = condition.Check(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+	}
+
+	if !res {
+		t.Fatalf("Error: expected condition.Check() to be true! (--insecure skips verification)")
+	}
+
+	condition = HttpOkCondition{Url: "ftp://localhost/"}
+	_, err = condition.Init(ctx)
+	if err == nil {
+		t.Fatalf("Error: expected HttpOkCondition.Init to reject an ftp url")
+	}
+}
+
+func TestWaitForConditionTimeout(t *testing.T) {
+	var err error
+	marker := "./testing/tmp/TestWaitForConditionTimeout.txt"
+	ctx := &Context{Timeout: 250 * time.Millisecond, TimeoutNotifiers: []Notification{CommandNotification{Command: "touch " + marker}}}
+
+	err = SetupEnsureFileDoesNotExist(t, TEST_FILE_NAME)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: TEST_FILE_NAME=%s; err=%v", TEST_FILE_NAME, err)
+	}
+
+	err = SetupEnsureFileDoesNotExist(t, marker)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: marker=%s; err=%v", marker, err)
+	}
+
+	start := time.Now()
+	err = ctx.WaitForCondition(FileExistsCondition{FileName: TEST_FILE_NAME})
+	elapsed := time.Since(start)
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("Error: expected a TimeoutError, got err=%v", err)
+	}
+
+	if ExitCodeForError(err) != ExitTimeout {
+		t.Fatalf("Error: expected exit code %d for a timeout, got %d", ExitTimeout, ExitCodeForError(err))
+	}
+
+	if elapsed < ctx.Timeout || elapsed > ctx.Timeout+time.Second {
+		t.Fatalf("Error: expected the wait to give up after ~%s, it took %s", ctx.Timeout, elapsed)
+	}
+
+	_, err = os.Stat(marker)
+	if err != nil {
+		t.Fatalf("Error: expected --on-timeout-run to have created marker=%s; err=%v", marker, err)
+	}
+}
+
+func TestWaitForConditionTimeoutHungProbe(t *testing.T) {
+	var err error
+	marker := "./testing/tmp/TestWaitForConditionTimeoutHungProbe.txt"
+	ctx := &Context{
+		Timeout:            500 * time.Millisecond,
+		TimeoutNotifiers:   []Notification{CommandNotification{Command: "touch " + marker}},
+		InterruptNotifiers: []Notification{CommandNotification{Command: "echo interrupted > " + marker}},
+	}
+
+	err = SetupEnsureFileDoesNotExist(t, marker)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: marker=%s; err=%v", marker, err)
+	}
+
+	// NB: the probe is stopped at the deadline, the wait doesn't sit in it
+	start := time.Now()
+	err = ctx.WaitForCondition(CommandSucceedsCondition{CommandStr: "sleep 1000", Quiet: true})
+	elapsed := time.Since(start)
+
+	if ExitCodeForError(err) != ExitTimeout {
+		t.Fatalf("Error: expected exit code %d for a timeout, got %d; err=%v", ExitTimeout, ExitCodeForError(err), err)
+	}
+
+	if elapsed > ctx.Timeout+2*time.Second {
+		t.Fatalf("Error: expected the hung probe to be given up on after ~%s, it took %s", ctx.Timeout, elapsed)
+	}
+
+	contents, err := os.ReadFile(marker)
+	if err != nil || len(contents) != 0 {
+		t.Fatalf("Error: expected only --on-timeout-run to have been run, got=%q; err=%v", contents, err)
+	}
+}
+
+func TestParseDeadline(t *testing.T) {
+	deadline, err := ParseDeadline("2026-10-18T09:00")
+	if err != nil {
+		t.Fatalf("Error: failed to parse deadline; err=%v", err)
+	}
+
+	expected := time.Date(2026, 10, 18, 9, 0, 0, 0, time.Local)
+	if !deadline.Equal(expected) {
+		t.Fatalf("Error: expected deadline=%v, got %v", expected, deadline)
+	}
+
+	ctx := &Context{Timeout: time.Hour, Deadline: expected}
+	start := expected.Add(-10 * time.Minute)
+	if !ctx.DeadlineFrom(start).Equal(expected) {
+		t.Fatalf("Error: expected the earlier --deadline to win, got %v", ctx.DeadlineFrom(start))
+	}
+
+	_, err = ParseDeadline("tomorrow-ish")
+	if err == nil {
+		t.Fatalf("Error: expected an unparseable deadline to be an error")
+	}
+}
+
+func TestPollerBackoff(t *testing.T) {
+	poller := NewPoller(PollPolicy{Interval: 100 * time.Millisecond, MaxInterval: 500 * time.Millisecond, BackoffFactor: 2.0})
+	expected := []time.Duration{100, 200, 400, 500, 500}
+	for idx, ms := range expected {
+		sleepFor := poller.Next()
+		if sleepFor != ms*time.Millisecond {
+			t.Fatalf("Error: expected sleep %d to be %dms, got %s", idx, ms, sleepFor)
+		}
+	}
+
+	poller = NewPoller(PollPolicy{Interval: time.Second, MaxInterval: time.Second, BackoffFactor: 1.0, Jitter: 0.25})
+	for idx := 0; idx < 100; idx++ {
+		sleepFor := poller.Next()
+		if sleepFor < 750*time.Millisecond || sleepFor > 1250*time.Millisecond {
+			t.Fatalf("Error: expected jittered sleep to be within +/-25%% of 1s, got %s", sleepFor)
+		}
+	}
+}
+
+func TestPollPolicyFor(t *testing.T) {
+	// file checks are cheap and use the defaults
+	policy := PollPolicyFor(PollPolicy{}, FileExistsCondition{FileName: TEST_FILE_NAME})
+	if policy != DefaultPollPolicy {
+		t.Fatalf("Error: expected the default poll policy, got %+v", policy)
+	}
+
+	// ** globs walk the whole tree and can't be watched, they back off
+	policy = PollPolicyFor(PollPolicy{}, FileExistsCondition{FileName: "out/**/part-*.parquet"})
+	if policy.Interval != 2*time.Second || policy.BackoffFactor <= 1.0 {
+		t.Fatalf("Error: expected a ** glob to suggest a backoff, got %+v", policy)
+	}
+
+	policy = PollPolicyFor(PollPolicy{}, FileRemovedCondition{FileName: "locks/*.lock"})
+	if policy != DefaultPollPolicy {
+		t.Fatalf("Error: expected the default poll policy, got %+v", policy)
+	}
+
+	// commands suggest their own slower cadence
+	policy = PollPolicyFor(PollPolicy{}, CommandSucceedsCondition{CommandStr: "true"})
+	if policy.Interval != time.Second || policy.BackoffFactor <= 1.0 {
+		t.Fatalf("Error: expected CommandSucceedsCondition to suggest a backoff, got %+v", policy)
+	}
+
+	// the command line wins over the suggestion
+	policy = PollPolicyFor(PollPolicy{Interval: time.Minute, BackoffFactor: 1.0}, CommandSucceedsCondition{CommandStr: "true"})
+	if policy.Interval != time.Minute || policy.MaxInterval != time.Minute || policy.BackoffFactor != 1.0 {
+		t.Fatalf("Error: expected --interval/--backoff-factor to override the suggestion, got %+v", policy)
+	}
+
+	err := PollPolicy{Jitter: 2.0}.Validate()
+	if err == nil {
+		t.Fatalf("Error: expected --jitter=2.0 to be rejected")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	config, err := LoadConfig("./sample-config.json")
+	if err != nil {
+		t.Fatalf("Error: failed to load sample-config.json; err=%v", err)
+	}
+
+	condition, err := config.Condition()
+	if err != nil {
+		t.Fatalf("Error: failed to build condition from sample-config.json; err=%v", err)
+	}
+
+	fileExists, ok := condition.(FileExistsCondition)
+	if !ok || fileExists.FileName != "./completed" {
+		t.Fatalf("Error: expected a FileExistsCondition for ./completed, got %#v", condition)
+	}
+
+	ctx := &Context{}
+	err = config.Apply(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed to apply sample-config.json; err=%v", err)
+	}
+
+	if len(ctx.Notifiers) != 1 || ctx.Notifiers[0] != (CommandNotification{Command: config.NotifyCommand}) {
+		t.Fatalf("Error: expected NotifyCommand to be applied, got Notifiers=%v", ctx.Notifiers)
+	}
+
+	config = Config{WaitOn: "WaitOnHttpsHeadOk", HostOrAddress: "example.com", Port: "8443"}
+	condition, err = config.Condition()
+	if err != nil {
+		t.Fatalf("Error: failed to build condition from config; err=%v", err)
+	}
+
+	if condition.(HttpOkCondition).Url != "https://example.com:8443/" {
+		t.Fatalf("Error: expected an https url, got %s", condition.(HttpOkCondition).Url)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	fname := "./testing/tmp/TestLoadConfigInvalid.json"
+	err := SetupEnsureFile(t, fname, `{"WaitOn": "WaitOnPidExit", "DoNotify": true, "NotifyType": "NotifyViaCommand"}`)
+	if err != nil {
+		t.Fatalf("Error: unable to write config: fname=%s; err=%v", fname, err)
+	}
+
+	_, err = LoadConfig(fname)
+	if err == nil {
+		t.Fatalf("Error: expected LoadConfig to reject a config missing Pid and NotifyCommand")
+	}
+
+	for _, field := range []string{"requires Pid", "requires NotifyCommand"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Fatalf("Error: expected the error to mention '%s', got err=%v", field, err)
+		}
+	}
+
+	err = SetupEnsureFile(t, fname, `{"WaitOn": "WaitOnFileExists", "FileNmae": "./typo"}`)
+	if err != nil {
+		t.Fatalf("Error: unable to write config: fname=%s; err=%v", fname, err)
+	}
+
+	_, err = LoadConfig(fname)
+	if err == nil || !strings.Contains(err.Error(), "FileNmae") {
+		t.Fatalf("Error: expected LoadConfig to reject the unknown field FileNmae, got err=%v", err)
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	var err error
+	var payload EventPayload
+	var gets int
+	marker := "./testing/tmp/TestNotifications.txt"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			gets++
+		case http.MethodPost:
+			err := json.NewDecoder(r.Body).Decode(&payload)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	err = SetupEnsureFile(t, TEST_FILE_NAME, "some file contents")
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file exists: TEST_FILE_NAME=%s; err=%v", TEST_FILE_NAME, err)
+	}
+
+	err = SetupEnsureFileDoesNotExist(t, marker)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: marker=%s; err=%v", marker, err)
+	}
+
+	ctx := &Context{Notifiers: []Notification{
+		CommandNotification{Command: "exit 1"},
+		CommandNotification{Command: "touch " + marker},
+		HttpGetNotification{Url: server.URL},
+		HttpPostNotification{Url: server.URL},
+	}}
+
+	// a failing notification is reported, but doesn't stop the others
+	err = ctx.WaitForCondition(FileExistsCondition{FileName: TEST_FILE_NAME})
+	if err == nil || !strings.Contains(err.Error(), "exit 1") {
+		t.Fatalf("Error: expected the failed CommandNotification to be reported, got err=%v", err)
+	}
+
+	_, err = os.Stat(marker)
+	if err != nil {
+		t.Fatalf("Error: expected CommandNotification to have created marker=%s; err=%v", marker, err)
+	}
+
+	if gets != 1 {
+		t.Fatalf("Error: expected HttpGetNotification to make 1 request, made %d", gets)
+	}
+
+	if payload.WaitOn != "WaitOnFileExists" || payload.Target != TEST_FILE_NAME || payload.Outcome != OutcomeSucceeded {
+		t.Fatalf("Error: unexpected HttpPostNotification payload=%+v", payload)
+	}
+
+	if payload.StartTime.IsZero() || payload.EndTime.Before(payload.StartTime) {
+		t.Fatalf("Error: expected HttpPostNotification payload to have timing, payload=%+v", payload)
+	}
+}
+
+func TestProgressNotifications(t *testing.T) {
+	var err error
+	notifyLog := "./testing/tmp/TestProgressNotifications.log"
+	ctx := &Context{
+		NotifyEvery: 100 * time.Millisecond,
+		Notifiers:   []Notification{CommandNotification{Command: `echo "$TMW_OUTCOME $TMW_FINAL" >> ` + notifyLog}},
+	}
+
+	err = SetupEnsureFileDoesNotExist(t, TEST_FILE_NAME)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: TEST_FILE_NAME=%s; err=%v", TEST_FILE_NAME, err)
+	}
+
+	err = SetupEnsureFileDoesNotExist(t, notifyLog)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: notifyLog=%s; err=%v", notifyLog, err)
+	}
+
+	go func() {
+		time.Sleep(450 * time.Millisecond)
+		_ = os.WriteFile(TEST_FILE_NAME, []byte("some file contents"), 0o0644)
+	}()
+
+	err = ctx.WaitForCondition(FileExistsCondition{FileName: TEST_FILE_NAME})
+	if err != nil {
+		t.Fatalf("Error: WaitForCondition failed; err=%v", err)
+	}
+
+	contents, err := os.ReadFile(notifyLog)
+	if err != nil {
+		t.Fatalf("Error: unable to read notifyLog=%s; err=%v", notifyLog, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) < 3 {
+		t.Fatalf("Error: expected at least 2 progress notifications and a final one, got lines=%v", lines)
+	}
+
+	for _, line := range lines[:len(lines)-1] {
+		if line != OutcomeWaiting+" false" {
+			t.Fatalf("Error: expected a progress notification, got line=%s", line)
+		}
+	}
+
+	if lines[len(lines)-1] != OutcomeSucceeded+" true" {
+		t.Fatalf("Error: expected the last notification to be final, got line=%s", lines[len(lines)-1])
+	}
+}
+
+func TestCompositeCondition(t *testing.T) {
+	var err error
+	var res bool
+	var condition Condition
+	ctx := &Context{}
+
+	err = SetupEnsureFileDoesNotExist(t, TEST_FILE_NAME)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: TEST_FILE_NAME=%s; err=%v", TEST_FILE_NAME, err)
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Error: unable to create listening socket for testing CompositeCondition: err=%v", err)
+	}
+	defer listener.Close()
+
+	address := fmt.Sprintf("localhost:%d", listener.Addr().(*net.TCPAddr).Port)
+	children := []Condition{FileExistsCondition{FileName: TEST_FILE_NAME}, SocketConnectCondition{Address: address}}
+
+	condition = CompositeCondition{Mode: CompositeAllOf, Children: children}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init CompositeCondition; err=%v", err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+	}
+
+	if res {
+		t.Fatalf("Error: expected all-of to be false, TEST_FILE_NAME=%s does not exist", TEST_FILE_NAME)
+	}
+
+	details := condition.(Detailer).Details()
+	if details["fired_count"] != "1" || details["fired"] != "WaitOnSocketConnect "+address {
+		t.Fatalf("Error: expected only the socket to have fired, details=%v", details)
+	}
+
+	err = SetupEnsureFile(t, TEST_FILE_NAME, "some file contents")
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file exists: TEST_FILE_NAME=%s; err=%v", TEST_FILE_NAME, err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+	}
+
+	if !res {
+		t.Fatalf("Error: expected all-of to be true, both conditions are met")
+	}
+
+	condition = CompositeCondition{Mode: CompositeNOf, Need: 3, Children: children}
+	_, err = condition.Init(ctx)
+	if err == nil {
+		t.Fatalf("Error: expected n-of with --need=3 of 2 conditions to fail Init")
+	}
+
+	command := &NOfCmd{CompositeCmd: CompositeCmd{When: []string{"file-exists --file-name=" + TEST_FILE_NAME}}, Need: 3}
+	err = ctx.WaitForCommand(command)
+	if ExitCodeForError(err) != ExitBadArguments {
+		t.Fatalf("Error: expected n-of --need=3 of 1 condition to be a bad argument, got err=%v", err)
+	}
+}
+
+func TestCompositeConditionCheckErrorKeepsChildren(t *testing.T) {
+	var err error
+	var condition Condition
+	ctx := &Context{}
+
+	err = SetupEnsureFile(t, TEST_FILE_NAME, "some file contents")
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file exists: TEST_FILE_NAME=%s; err=%v", TEST_FILE_NAME, err)
+	}
+
+	condition = CompositeCondition{Mode: CompositeAllOf, Children: []Condition{
+		CommandExitedCondition{CommandStr: "echo done"},
+		FileUpdatedCondition{FileName: TEST_FILE_NAME},
+	}}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init CompositeCondition; err=%v", err)
+	}
+
+	// NB: the command finishes in the same pass that the file's check
+	// fails, the finished command (and its tail file) mustn't be lost
+	time.Sleep(250 * time.Millisecond)
+	err = os.Remove(TEST_FILE_NAME)
+	if err != nil {
+		t.Fatalf("Error: unable to remove TEST_FILE_NAME=%s; err=%v", TEST_FILE_NAME, err)
+	}
+
+	condition, _, err = condition.Check(ctx)
+	if err == nil {
+		t.Fatalf("Error: expected the check of the missing TEST_FILE_NAME=%s to fail", TEST_FILE_NAME)
+	}
+
+	command := condition.(CompositeCondition).Children[0].(CommandExitedCondition)
+	if !command.Finished || command.TailFile == "" {
+		t.Fatalf("Error: expected the finished command to have been kept, got finished=%v tailFile=%s", command.Finished, command.TailFile)
+	}
+
+	condition.(io.Closer).Close()
+	_, err = os.Stat(command.TailFile)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Error: expected Close to have removed tailFile=%s; err=%v", command.TailFile, err)
+	}
+}
+
+func TestCompositeConditionInitCloses(t *testing.T) {
+	var err error
+	ctx := &Context{}
+	if runtime.GOOS != "linux" {
+		t.Skipf("processes are only listed from /proc on linux")
+	}
+
+	err = SetupEnsureFileDoesNotExist(t, TEST_FILE_NAME)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: TEST_FILE_NAME=%s; err=%v", TEST_FILE_NAME, err)
+	}
+
+	// NB: the command is started by its Init, the missing file then fails
+	// the all-of's, which has to stop the command rather than orphan it
+	condition := CompositeCondition{Mode: CompositeAllOf, Children: []Condition{
+		CommandExitedCondition{CommandStr: "sleep 7.77"},
+		FileUpdatedCondition{FileName: TEST_FILE_NAME},
+	}}
+	_, err = condition.Init(ctx)
+	if err == nil {
+		t.Fatalf("Error: expected all-of with a missing TEST_FILE_NAME=%s to fail Init", TEST_FILE_NAME)
+	}
+
+	matcher, _ := NewProcMatcher(`sleep 7\.77$`, true, "", 0)
+	matched, err := matcher.MatchProcs()
+	if err != nil {
+		t.Fatalf("Error: unable to list processes; err=%v", err)
+	}
+
+	if len(matched) != 0 {
+		t.Fatalf("Error: expected the command to have been stopped, found procs=%v", matched)
+	}
+}
+
+func TestParseConditionSpec(t *testing.T) {
+	args, err := SplitSpec(`file-exists --file-name="./some file.txt" --x='a "b"' c\ d`)
+	if err != nil {
+		t.Fatalf("Error: failed to split spec; err=%v", err)
+	}
+
+	expected := []string{"file-exists", "--file-name=./some file.txt", `--x=a "b"`, "c d"}
+	if strings.Join(args, "|") != strings.Join(expected, "|") {
+		t.Fatalf("Error: expected args=%q, got %q", expected, args)
+	}
+
+	condition, err := ParseConditionSpec("socket-connect --address=localhost:5432 --network=tcp6")
+	if err != nil {
+		t.Fatalf("Error: failed to parse spec; err=%v", err)
+	}
+
+	if condition.(SocketConnectCondition).Network != "tcp6" || condition.Target() != "localhost:5432" {
+		t.Fatalf("Error: unexpected condition from spec, condition=%#v", condition)
+	}
+
+	condition, err = ParseConditionSpec(`any-of --when="file-exists --file-name=./a" --when="file-exists --file-name=./b"`)
+	if err != nil {
+		t.Fatalf("Error: failed to parse a nested spec; err=%v", err)
+	}
+
+	if len(condition.(CompositeCondition).Children) != 2 {
+		t.Fatalf("Error: expected a nested any-of with 2 children, condition=%#v", condition)
+	}
+
+	_, err = ParseConditionSpec("file-exists --file-name='./unterminated")
+	if err == nil {
+		t.Fatalf("Error: expected an unterminated quote to be an error")
+	}
+}
+
+func TestWatchedFileExistsCondition(t *testing.T) {
+	var err error
+	var res bool
+	var condition Condition
+	ctx := &Context{}
+
+	watch, err := NewFileWatch()
+	if errors.Is(err, ErrWatchUnsupported) {
+		t.Skipf("file watching is not supported on this platform")
+	}
+
+	if err != nil {
+		t.Fatalf("Error: unable to create file watch; err=%v", err)
+	}
+	defer watch.Close()
+
+	err = SetupEnsureFileDoesNotExist(t, TEST_FILE_NAME)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: TEST_FILE_NAME=%s; err=%v", TEST_FILE_NAME, err)
+	}
+
+	condition = FileExistsCondition{FileName: TEST_FILE_NAME}
+	condition, err = condition.(Watchable).Watch(ctx, watch)
+	if err != nil {
+		t.Fatalf("Error: unable to watch FileExistsCondition; err=%v", err)
+	}
+
+	// a file that comes and goes between checks is missed by os.Stat
+	err = SetupEnsureFile(t, TEST_FILE_NAME, "some file contents")
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file exists: TEST_FILE_NAME=%s; err=%v", TEST_FILE_NAME, err)
+	}
+
+	err = SetupEnsureFileDoesNotExist(t, TEST_FILE_NAME)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: TEST_FILE_NAME=%s; err=%v", TEST_FILE_NAME, err)
+	}
+
+	select {
+	case <-watch.Events():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Error: expected the file watch to wake us up")
+	}
+
+	_, res, err = condition.Check(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+	}
+
+	if !res {
+		t.Fatalf("Error: expected condition.Check() to be true! (TEST_FILE_NAME=%s was created, then removed)", TEST_FILE_NAME)
+	}
+}
+
+func TestPidExitedConditionStatus(t *testing.T) {
+	var err error
+	var res bool
+	var condition Condition
+	ctx := &Context{}
+	if runtime.GOOS != "linux" {
+		t.Skipf("exit statuses are only recovered from /proc on linux")
+	}
+
+	cmd := exec.Command("bash", "-c", "sleep 0.2; exit 3")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("Error: failed to exec/Start bash; err=%v", err)
+	}
+
+	condition = PidExitedCondition{Pid: cmd.Process.Pid}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init PidExitedCondition; err=%v", err)
+	}
+	defer condition.(io.Closer).Close()
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+	}
+
+	if res {
+		t.Fatalf("Error: expected condition.Check() to be false! (pid=%d should be running)", cmd.Process.Pid)
+	}
+
+	// NB: the pidfd wakes us when bash exits, it stays a zombie (with its
+	// exit code in /proc/<pid>/stat) until we reap it below
+	SleepOrWake(5*time.Second, condition.(Waker).WakeOn())
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+	}
+
+	if !res {
+		t.Fatalf("Error: expected condition.Check() to be true! (pid=%d should have exited)", cmd.Process.Pid)
+	}
+
+	details := condition.(Detailer).Details()
+	if details["exit_code"] != "3" {
+		t.Fatalf("Error: expected exit_code=3, got details=%v", details)
+	}
+
+	_ = cmd.Wait()
+
+	// once it's been reaped there's no telling how it exited, which
+	// mustn't be mistaken for it exiting the way that was hoped for
+	expectSuccess, _ := ParseExitExpectation([]string{"0"}, nil)
+	condition = PidExitedCondition{Pid: cmd.Process.Pid, Expect: expectSuccess}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init PidExitedCondition; err=%v", err)
+	}
+	defer condition.(io.Closer).Close()
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || !res {
+		t.Fatalf("Error: expected the reaped pid=%d to have exited, res=%v; err=%v", cmd.Process.Pid, res, err)
+	}
+
+	err = condition.(Expecter).Unexpected()
+	details = condition.(Detailer).Details()
+	var unknownErr *UnknownExitError
+	if !errors.As(err, &unknownErr) || ExitCodeForError(err) != ExitUnknownExit || details["exit_status"] != "unknown" {
+		t.Fatalf("Error: expected an unknown exit status, got details=%v; err=%v", details, err)
+	}
+}
+
+func TestCommandExitedConditionNotifies(t *testing.T) {
+	var err error
+	notifyLog := "./testing/tmp/TestCommandExitedConditionNotifies.log"
+
+	err = SetupEnsureFileDoesNotExist(t, notifyLog)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: notifyLog=%s; err=%v", notifyLog, err)
+	}
+
+	ctx := &Context{Notifiers: []Notification{
+		CommandNotification{Command: `(cat "$TMW_TAIL_FILE"; echo "code=$TMW_EXIT_CODE"; echo "tail_file=$TMW_TAIL_FILE") > ` + notifyLog},
+	}}
+
+	// a non-zero exit is still the command exiting, not an error
+	condition := CommandExitedCondition{CommandStr: "echo zero; sleep 0.1; echo err >&2; sleep 0.1; echo one; echo two; exit 7", TailLines: 3}
+	err = ctx.WaitForCondition(condition)
+	if err != nil {
+		t.Fatalf("Error: expected WaitForCondition to succeed; err=%v", err)
+	}
+
+	contents, err := os.ReadFile(notifyLog)
+	if err != nil {
+		t.Fatalf("Error: expected the notification to have written notifyLog=%s; err=%v", notifyLog, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) != 5 || strings.Join(lines[:4], ",") != "err,one,two,code=7" {
+		t.Fatalf("Error: expected the tail and exit code to be passed to the notification, got=%q", contents)
+	}
+
+	tailFile := strings.TrimPrefix(lines[4], "tail_file=")
+	_, err = os.Stat(tailFile)
+	if !os.IsNotExist(err) {
+		t.Fatalf("Error: expected tailFile=%s to be removed once the wait is over; err=%v", tailFile, err)
+	}
+
+	if ctx.Event.Details["exit_code"] != "7" || ctx.Event.Details["duration"] == "" {
+		t.Fatalf("Error: expected the event details to have the exit code and duration, got details=%v", ctx.Event.Details)
+	}
+}
+
+func TestNotificationTemplates(t *testing.T) {
+	var err error
+	var path, contentType, body string
+	notifyLog := "./testing/tmp/TestNotificationTemplates.log"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contents, _ := io.ReadAll(r.Body)
+		path, contentType, body = r.URL.Path, r.Header.Get("Content-Type"), string(contents)
+	}))
+	defer server.Close()
+
+	err = SetupEnsureFileDoesNotExist(t, notifyLog)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: notifyLog=%s; err=%v", notifyLog, err)
+	}
+
+	message, err := ParseTemplate("message", "{{.Kind}} {{.Target}}: {{.Outcome}}")
+	if err != nil {
+		t.Fatalf("Error: unable to parse the message template; err=%v", err)
+	}
+
+	hostname, _ := os.Hostname()
+	ctx := &Context{
+		MessageTemplate: message,
+		Notifiers: []Notification{
+			CommandNotification{Command: `echo "{{.Kind}}|{{.ExitCode}}|{{.Hostname}}|$TMW_MESSAGE" > ` + notifyLog},
+			HttpPostNotification{Url: server.URL + "/{{.Outcome}}", Body: `{"text": "{{.Message}}"}`},
+		},
+	}
+
+	err = ctx.WaitForCondition(CommandExitedCondition{CommandStr: "exit 3"})
+	if err != nil {
+		t.Fatalf("Error: expected WaitForCondition to succeed; err=%v", err)
+	}
+
+	contents, err := os.ReadFile(notifyLog)
+	if err != nil {
+		t.Fatalf("Error: expected the notification to have written notifyLog=%s; err=%v", notifyLog, err)
+	}
+
+	expected := "WaitOnCommandExit|3|" + hostname + "|WaitOnCommandExit exit 3: succeeded\n"
+	if string(contents) != expected {
+		t.Fatalf("Error: expected the rendered command to write %q, got=%q", expected, contents)
+	}
+
+	if path != "/succeeded" || contentType != "application/json" || body != `{"text": "WaitOnCommandExit exit 3: succeeded"}` {
+		t.Fatalf("Error: unexpected rendered post path=%s contentType=%s body=%s", path, contentType, body)
+	}
+
+	_, err = NewNotification(NotifyViaCommand, "echo {{.Oops")
+	if err == nil {
+		t.Fatalf("Error: expected NewNotification to reject an invalid template")
+	}
+}
+
+func TestNotificationTemplatesQuoting(t *testing.T) {
+	var err error
+	var contentType, body string
+	logFile := "./testing/tmp/TestNotificationTemplatesQuoting.log"
+	notifyLog := "./testing/tmp/TestNotificationTemplatesQuoting.notify.log"
+	marker := "./testing/tmp/TestNotificationTemplatesQuoting.pwned"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contents, _ := io.ReadAll(r.Body)
+		contentType, body = r.Header.Get("Content-Type"), string(contents)
+	}))
+	defer server.Close()
+
+	for _, fname := range []string{logFile, notifyLog, marker} {
+		err = SetupEnsureFileDoesNotExist(t, fname)
+		if err != nil {
+			t.Fatalf("Error: unable to ensure file does not exist: fname=%s; err=%v", fname, err)
+		}
+	}
+
+	// a hostile log line, quotes and all
+	line := `up "it's" $(touch ` + marker + `) ` + "`touch " + marker + "`"
+	err = os.WriteFile(logFile, []byte(line+"\n"), 0644)
+	if err != nil {
+		t.Fatalf("Error: unable to write logFile=%s; err=%v", logFile, err)
+	}
+
+	condition, err := NewFileContainsCondition(logFile, "^up ", "", true, 1)
+	if err != nil {
+		t.Fatalf("Error: unable to create the condition; err=%v", err)
+	}
+
+	ctx := &Context{
+		Notifiers: []Notification{
+			CommandNotification{Command: `echo {{shellquote .Details.matched_line}} > ` + notifyLog},
+			CommandNotification{Command: `echo "$TMW_MATCHED_LINE" >> ` + notifyLog},
+			HttpPostNotification{Url: server.URL, Body: `{"text": {{json .Details.matched_line}}}`},
+		},
+	}
+
+	err = ctx.WaitForCondition(condition)
+	if err != nil {
+		t.Fatalf("Error: expected WaitForCondition to succeed; err=%v", err)
+	}
+
+	_, err = os.Stat(marker)
+	if err == nil {
+		t.Fatalf("Error: expected the matched line not to be run as a command, marker=%s exists", marker)
+	}
+
+	contents, err := os.ReadFile(notifyLog)
+	if err != nil || string(contents) != line+"\n"+line+"\n" {
+		t.Fatalf("Error: expected the matched line to be echoed as is, got=%q; err=%v", contents, err)
+	}
+
+	var payload struct{ Text string }
+	err = json.Unmarshal([]byte(body), &payload)
+	if err != nil || contentType != "application/json" || payload.Text != line {
+		t.Fatalf("Error: expected a json body with the matched line, contentType=%s body=%s; err=%v", contentType, body, err)
+	}
+}
+
+func TestUrlNotifications(t *testing.T) {
+	notifications, err := UrlNotifications([]string{"http://a/{{.Outcome}}", "http://b"}, NotifyViaHttpGet, "")
+	if err != nil || len(notifications) != 2 || notifications[1] != (HttpGetNotification{Url: "http://b"}) {
+		t.Fatalf("Error: expected two GET notifications, got=%v; err=%v", notifications, err)
+	}
+
+	notifications, err = UrlNotifications([]string{"http://a"}, NotifyViaHttpPost, `{"text": {{json .Message}}}`)
+	if err != nil || notifications[0] != (HttpPostNotification{Url: "http://a", Body: `{"text": {{json .Message}}}`}) {
+		t.Fatalf("Error: expected a POST of the body, got=%v; err=%v", notifications, err)
+	}
+
+	_, err = UrlNotifications([]string{"http://a/{{.Oops"}, NotifyViaHttpPost, "")
+	if err == nil {
+		t.Fatalf("Error: expected UrlNotifications to reject an invalid template")
+	}
+}
+
+func TestConditionErrorNotifiesFailure(t *testing.T) {
+	var err error
+	notifyLog := "./testing/tmp/TestConditionErrorNotifiesFailure.log"
+	marker := "./testing/tmp/TestConditionErrorNotifiesFailure.txt"
+
+	err = SetupEnsureFileDoesNotExist(t, TEST_FILE_NAME)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: TEST_FILE_NAME=%s; err=%v", TEST_FILE_NAME, err)
+	}
+
+	for _, fname := range []string{notifyLog, marker} {
+		err = SetupEnsureFileDoesNotExist(t, fname)
+		if err != nil {
+			t.Fatalf("Error: unable to ensure file does not exist: fname=%s; err=%v", fname, err)
+		}
+	}
+
+	ctx := &Context{
+		Notifiers:        []Notification{CommandNotification{Command: "echo notify >> " + notifyLog}},
+		SuccessNotifiers: []Notification{CommandNotification{Command: "echo success >> " + notifyLog}},
+		FailureNotifiers: []Notification{CommandNotification{Command: `echo "failure $TMW_OUTCOME" >> ` + notifyLog}},
+		ErrorNotifiers:   []Notification{CommandNotification{Command: `echo "$TMW_ERROR" > ` + marker}},
+		TimeoutNotifiers: []Notification{CommandNotification{Command: "echo timeout >> " + notifyLog}},
+	}
+
+	// a file that doesn't exist can't be checked for updates
+	err = ctx.WaitForCondition(FileUpdatedCondition{FileName: TEST_FILE_NAME})
+	if err == nil {
+		t.Fatalf("Error: expected FileUpdatedCondition on a missing file to fail")
+	}
+
+	contents, err := os.ReadFile(notifyLog)
+	if err != nil || string(contents) != "failure error\n" {
+		t.Fatalf("Error: expected only the failure notifier to be run, got=%q; err=%v", contents, err)
+	}
+
+	contents, err = os.ReadFile(marker)
+	if err != nil || !strings.Contains(string(contents), TEST_FILE_NAME) {
+		t.Fatalf("Error: expected the error notifier to be given the error, got=%q; err=%v", contents, err)
+	}
+}
+
+func TestExitCodeForError(t *testing.T) {
+	cause := errors.New("boom")
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{nil, ExitSuccess},
+		{cause, ExitConditionError},
+		{&CheckError{Description: "WaitOnFileChanged ./x", Err: cause}, ExitConditionError},
+		{&BadArgumentsError{Err: cause}, ExitBadArguments},
+		{&InitError{Description: "WaitOnCommandExit false", Err: cause}, ExitInitFailed},
+		{&NotifyError{Err: errors.Join(cause, cause)}, ExitNotifyFailed},
+		{&TimeoutError{StartTime: time.Now(), Deadline: time.Now()}, ExitTimeout},
+		{&InterruptedError{Signal: os.Interrupt}, ExitInterrupted},
+		{&UnexpectedExitError{Status: &ExitStatus{Code: 4}}, ExitUnexpectedExit},
+		{&UnexpectedExitError{Status: &ExitStatus{Code: 0}}, ExitUnexpectedExit},
+		{fmt.Errorf("wrapped: %w", &InitError{Err: cause}), ExitInitFailed},
+	}
+
+	for _, test := range tests {
+		code := ExitCodeForError(test.err)
+		if code != test.expected {
+			t.Fatalf("Error: expected exit code %d for err=%v, got %d", test.expected, test.err, code)
+		}
+	}
+
+	summary := ErrorSummary(&NotifyError{Err: errors.Join(cause, cause, cause)})
+	if summary != "unable to notify: boom (and 2 more, see --verbose)" {
+		t.Fatalf("Error: expected a one line summary, got=%q", summary)
+	}
+}
+
+func TestNotifyFailedExitCode(t *testing.T) {
+	var err error
+
+	err = SetupEnsureFile(t, TEST_FILE_NAME, "some file contents")
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file exists: TEST_FILE_NAME=%s; err=%v", TEST_FILE_NAME, err)
+	}
+
+	ctx := &Context{Notifiers: []Notification{CommandNotification{Command: "exit 1"}}}
+	err = ctx.WaitForCondition(FileExistsCondition{FileName: TEST_FILE_NAME})
+	if ExitCodeForError(err) != ExitNotifyFailed {
+		t.Fatalf("Error: expected exit code %d when a notification fails, got %d; err=%v", ExitNotifyFailed, ExitCodeForError(err), err)
+	}
+}
+
+func TestWaitForConditionInterrupted(t *testing.T) {
+	var err error
+	marker := "./testing/tmp/TestWaitForConditionInterrupted.txt"
+	notifyLog := "./testing/tmp/TestWaitForConditionInterrupted.log"
+	if runtime.GOOS == "windows" {
+		t.Skipf("signals can't be forwarded to process groups on windows")
+	}
+
+	for _, fname := range []string{marker, notifyLog} {
+		err = SetupEnsureFileDoesNotExist(t, fname)
+		if err != nil {
+			t.Fatalf("Error: unable to ensure file does not exist: fname=%s; err=%v", fname, err)
+		}
+	}
+
+	interruptCtx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	ctx := &Context{
+		Ctx:                interruptCtx,
+		InterruptNotifiers: []Notification{CommandNotification{Command: `echo "$TMW_OUTCOME" > ` + notifyLog}},
+	}
+
+	time.AfterFunc(250*time.Millisecond, func() {
+		cancel(&InterruptedError{Signal: syscall.SIGINT})
+	})
+
+	// the signal goes to the command's whole process group, sleep included
+	start := time.Now()
+	err = ctx.WaitForCondition(CommandExitedCondition{CommandStr: "trap 'echo interrupted > " + marker + "; exit 5' INT; sleep 10; true"})
+	elapsed := time.Since(start)
+
+	if ExitCodeForError(err) != ExitInterrupted {
+		t.Fatalf("Error: expected exit code %d for an interrupt, got %d; err=%v", ExitInterrupted, ExitCodeForError(err), err)
+	}
+
+	if elapsed > 5*time.Second {
+		t.Fatalf("Error: expected the command to be stopped promptly, it took %s", elapsed)
+	}
+
+	contents, err := os.ReadFile(marker)
+	if err != nil || string(contents) != "interrupted\n" {
+		t.Fatalf("Error: expected the command to have been sent SIGINT, got=%q; err=%v", contents, err)
+	}
+
+	contents, err = os.ReadFile(notifyLog)
+	if err != nil || string(contents) != "interrupted\n" {
+		t.Fatalf("Error: expected the interrupt notification to be sent, got=%q; err=%v", contents, err)
+	}
+}
+
+func TestFileContainsCondition(t *testing.T) {
+	var err error
+	var res bool
+	var condition Condition
+	ctx := &Context{}
+	logFile := "./testing/tmp/TestFileContainsCondition.log"
+
+	err = SetupEnsureFile(t, logFile, "Server started (a previous run)\n")
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file exists: logFile=%s; err=%v", logFile, err)
+	}
+
+	condition, err = NewFileContainsCondition(logFile, "Server started", "FATAL", false, 2)
+	if err != nil {
+		t.Fatalf("Error: failed to create FileContainsCondition; err=%v", err)
+	}
+
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init FileContainsCondition; err=%v", err)
+	}
+	defer condition.(io.Closer).Close()
+
+	appendLine := func(line string) {
+		file, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatalf("Error: unable to append to logFile=%s; err=%v", logFile, err)
+		}
+		defer file.Close()
+		fmt.Fprint(file, line)
+	}
+
+	// lines already in the file are skipped, partial lines aren't matched yet
+	appendLine("Server started on :8080\nServer sta")
+	condition, res, err = condition.Check(ctx)
+	if err != nil || res {
+		t.Fatalf("Error: expected only 1 of 2 matches, got res=%v err=%v details=%v", res, err, condition.(Detailer).Details())
+	}
+
+	// rotating the log: the new file is read from the start
+	err = os.Rename(logFile, logFile+".1")
+	if err != nil {
+		t.Fatalf("Error: unable to rotate logFile=%s; err=%v", logFile, err)
+	}
+
+	err = SetupEnsureFile(t, logFile, "Server started on :8081\n")
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file exists: logFile=%s; err=%v", logFile, err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || !res {
+		t.Fatalf("Error: expected the second match to be in the rotated file, got res=%v err=%v", res, err)
+	}
+
+	details := condition.(Detailer).Details()
+	if details["matched_line"] != "Server started on :8081" || details["matches"] != "2" {
+		t.Fatalf("Error: unexpected details=%v", details)
+	}
+}
+
+func TestFileContainsConditionErrorPattern(t *testing.T) {
+	var err error
+	ctx := &Context{}
+	logFile := "./testing/tmp/TestFileContainsConditionErrorPattern.log"
+
+	err = SetupEnsureFile(t, logFile, "booting\nFATAL: no space left on device\nServer started\n")
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file exists: logFile=%s; err=%v", logFile, err)
+	}
+
+	condition, err := NewFileContainsCondition(logFile, "Server started", "FATAL", true, 1)
+	if err != nil {
+		t.Fatalf("Error: failed to create FileContainsCondition; err=%v", err)
+	}
+
+	err = ctx.WaitForCondition(condition)
+	if err == nil || !strings.Contains(err.Error(), "no space left") {
+		t.Fatalf("Error: expected the error pattern to fail the wait, got err=%v", err)
+	}
+
+	if ctx.Event.Details["matched_line"] != "FATAL: no space left on device" {
+		t.Fatalf("Error: expected the failing line in the details, got details=%v", ctx.Event.Details)
+	}
+
+	_, err = NewFileContainsCondition(logFile, "Server (started", "", true, 1)
+	if err == nil {
+		t.Fatalf("Error: expected an invalid pattern to be rejected")
+	}
+}
+
+func TestFileStableCondition(t *testing.T) {
+	var err error
+	var res bool
+	var condition Condition
+	ctx := &Context{}
+	fname := "./testing/tmp/TestFileStableCondition.dat"
+
+	err = SetupEnsureFileDoesNotExist(t, fname)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: fname=%s; err=%v", fname, err)
+	}
+
+	condition = FileStableCondition{FileName: fname, QuietFor: 200 * time.Millisecond, Hash: true, MinSize: 10}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init FileStableCondition; err=%v", err)
+	}
+
+	// too small: stays quiet, but never reaches --min-size
+	err = SetupEnsureFile(t, fname, "small")
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file exists: fname=%s; err=%v", fname, err)
+	}
+
+	for range 3 {
+		condition, res, err = condition.Check(ctx)
+		if err != nil || res {
+			t.Fatalf("Error: expected a file under --min-size not to be stable, got res=%v err=%v", res, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	err = SetupEnsureFile(t, fname, "grown past the minimum size")
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file exists: fname=%s; err=%v", fname, err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || res {
+		t.Fatalf("Error: expected a file that just changed not to be stable, got res=%v err=%v", res, err)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	condition, res, err = condition.Check(ctx)
+	if err != nil || !res {
+		t.Fatalf("Error: expected the file to be stable after --quiet-for, got res=%v err=%v", res, err)
+	}
+
+	details := condition.(Detailer).Details()
+	if details["size"] != "27" || len(details["sha256"]) != 64 {
+		t.Fatalf("Error: unexpected details=%v", details)
+	}
+}
+
+func TestGlobFiles(t *testing.T) {
+	var err error
+	root := "./testing/tmp/TestGlobFiles"
+	err = os.RemoveAll(root)
+	if err != nil {
+		t.Fatalf("Error: unable to remove root=%s; err=%v", root, err)
+	}
+
+	for _, fname := range []string{"out/part-0.parquet", "out/a/part-1.parquet", "out/a/b/part-2.parquet", "out/a/b/_SUCCESS", "other/part-3.parquet"} {
+		fname = filepath.Join(root, fname)
+		err = os.MkdirAll(filepath.Dir(fname), 0o755)
+		if err != nil {
+			t.Fatalf("Error: unable to create the directory for fname=%s; err=%v", fname, err)
+		}
+
+		err = SetupEnsureFile(t, fname, "")
+		if err != nil {
+			t.Fatalf("Error: unable to ensure file exists: fname=%s; err=%v", fname, err)
+		}
+	}
+
+	tests := []struct {
+		pattern  string
+		expected int
+	}{
+		{"out/part-*.parquet", 1},
+		{"out/*/part-*.parquet", 1},
+		{"out/**/part-*.parquet", 3},
+		{"**/part-*.parquet", 4},
+		{"out/**/_SUCCESS", 1},
+		{"out/**", 7},
+		{"missing/**/x", 0},
+	}
+
+	for _, test := range tests {
+		matches, err := GlobFiles(filepath.Join(root, test.pattern))
+		if err != nil || len(matches) != test.expected {
+			t.Fatalf("Error: expected %d matches for pattern=%s, got matches=%v; err=%v", test.expected, test.pattern, matches, err)
+		}
+	}
+
+	err = ValidateGlob(filepath.Join(root, "out/[part"))
+	if err == nil {
+		t.Fatalf("Error: expected an unclosed [ to be rejected")
+	}
+}
+
+func TestFileExistsConditionGlob(t *testing.T) {
+	var err error
+	var res bool
+	var condition Condition
+	ctx := &Context{}
+	root := "./testing/tmp/TestFileExistsConditionGlob"
+	err = os.RemoveAll(root)
+	if err != nil {
+		t.Fatalf("Error: unable to remove root=%s; err=%v", root, err)
+	}
+
+	condition = FileExistsCondition{FileName: root + "/**/*.done", AtLeast: 2}
+	removed := Condition(FileRemovedCondition{FileName: root + "/**/*.done"})
+	for idx := range 2 {
+		condition, res, err = condition.Check(ctx)
+		if err != nil || res {
+			t.Fatalf("Error: expected fewer than 2 matches, got res=%v err=%v", res, err)
+		}
+
+		err = os.MkdirAll(fmt.Sprintf("%s/%d", root, idx), 0o755)
+		if err != nil {
+			t.Fatalf("Error: unable to create a directory under root=%s; err=%v", root, err)
+		}
+
+		err = SetupEnsureFile(t, fmt.Sprintf("%s/%d/job.done", root, idx), "")
+		if err != nil {
+			t.Fatalf("Error: unable to ensure file exists; err=%v", err)
+		}
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || !res {
+		t.Fatalf("Error: expected 2 matches, got res=%v err=%v", res, err)
+	}
+
+	details := condition.(Detailer).Details()
+	if details["match_count"] != "2" || !strings.Contains(details["matched_paths"], "1/job.done") {
+		t.Fatalf("Error: unexpected details=%v", details)
+	}
+
+	removed, res, err = removed.Check(ctx)
+	if err != nil || res {
+		t.Fatalf("Error: expected FileRemovedCondition to wait for no matches, got res=%v err=%v", res, err)
+	}
+
+	err = os.RemoveAll(root)
+	if err != nil {
+		t.Fatalf("Error: unable to remove root=%s; err=%v", root, err)
+	}
+
+	_, res, err = removed.Check(ctx)
+	if err != nil || !res {
+		t.Fatalf("Error: expected FileRemovedCondition once nothing matches, got res=%v err=%v", res, err)
+	}
+}
+
+func TestDirUpdatedConditionRecursive(t *testing.T) {
+	var err error
+	var res bool
+	var condition Condition
+	ctx := &Context{}
+	root := "./testing/tmp/TestDirUpdatedConditionRecursive"
+	err = os.RemoveAll(root)
+	if err != nil {
+		t.Fatalf("Error: unable to remove root=%s; err=%v", root, err)
+	}
+
+	for _, dir := range []string{"a/b", ".git"} {
+		err = os.MkdirAll(filepath.Join(root, dir), 0o755)
+		if err != nil {
+			t.Fatalf("Error: unable to create dir=%s under root=%s; err=%v", dir, root, err)
+		}
+	}
+
+	for _, name := range []string{"a/keep.txt", "a/b/old.txt", "a/gone.txt", ".git/HEAD"} {
+		err = SetupEnsureFile(t, filepath.Join(root, name), "contents")
+		if err != nil {
+			t.Fatalf("Error: unable to ensure file=%s exists; err=%v", name, err)
+		}
+	}
+
+	condition = DirUpdatedCondition{DirName: root, Recursive: true, Exclude: []string{".git", "*.tmp"}}
+	cFiles := Condition(DirUpdatedCondition{DirName: root, Recursive: true, Include: []string{"**/*.c"}})
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init DirUpdatedCondition; err=%v", err)
+	}
+
+	cFiles, err = cFiles.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init DirUpdatedCondition; err=%v", err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || res {
+		t.Fatalf("Error: expected no changes yet, got res=%v err=%v", res, err)
+	}
+
+	err = os.WriteFile(filepath.Join(root, ".git/HEAD"), []byte("excluded changes"), 0o644)
+	if err != nil {
+		t.Fatalf("Error: unable to write .git/HEAD; err=%v", err)
+	}
+
+	err = SetupEnsureFile(t, filepath.Join(root, "scratch.tmp"), "")
+	if err != nil {
+		t.Fatalf("Error: unable to create scratch.tmp; err=%v", err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || res {
+		t.Fatalf("Error: expected excluded changes to be ignored, got res=%v err=%v", res, err)
+	}
+
+	cFiles, res, err = cFiles.Check(ctx)
+	if err != nil || res {
+		t.Fatalf("Error: expected changes outside --include to be ignored, got res=%v err=%v", res, err)
+	}
+
+	err = os.WriteFile(filepath.Join(root, "a/keep.txt"), []byte("more contents"), 0o644)
+	if err != nil {
+		t.Fatalf("Error: unable to modify a/keep.txt; err=%v", err)
+	}
+
+	err = os.Rename(filepath.Join(root, "a/b/old.txt"), filepath.Join(root, "a/new.txt"))
+	if err != nil {
+		t.Fatalf("Error: unable to rename a/b/old.txt; err=%v", err)
+	}
+
+	err = os.Remove(filepath.Join(root, "a/gone.txt"))
+	if err != nil {
+		t.Fatalf("Error: unable to remove a/gone.txt; err=%v", err)
+	}
+
+	err = os.MkdirAll(filepath.Join(root, "a/b/c"), 0o755)
+	if err != nil {
+		t.Fatalf("Error: unable to create a/b/c; err=%v", err)
+	}
+
+	err = SetupEnsureFile(t, filepath.Join(root, "a/b/c/main.c"), "int main() { return 0; }")
+	if err != nil {
+		t.Fatalf("Error: unable to create a/b/c/main.c; err=%v", err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || !res {
+		t.Fatalf("Error: expected changes to be seen, got res=%v err=%v", res, err)
+	}
+
+	details := condition.(Detailer).Details()
+	expected := map[string]string{
+		"change_count": "5",
+		"added":        "a/b/c/\na/b/c/main.c",
+		"removed":      "a/gone.txt",
+		"modified":     "a/keep.txt",
+		"renamed":      "a/b/old.txt -> a/new.txt",
+	}
+
+	for key, value := range expected {
+		if details[key] != value {
+			t.Fatalf("Error: expected %s=%q, got details=%v", key, value, details)
+		}
+	}
+
+	cFiles, res, err = cFiles.Check(ctx)
+	if err != nil || !res {
+		t.Fatalf("Error: expected a/b/c/main.c to be seen, got res=%v err=%v", res, err)
+	}
+
+	details = cFiles.(Detailer).Details()
+	if details["change_count"] != "1" || details["added"] != "a/b/c/main.c" {
+		t.Fatalf("Error: expected only a/b/c/main.c with --include, got details=%v", details)
+	}
+}
+
+func TestWatchedUpdatedConditionsIgnoreChmod(t *testing.T) {
+	var err error
+	var res bool
+	ctx := &Context{}
+	fileName := "./testing/tmp/TestWatchedUpdatedConditionsIgnoreChmod.txt"
+	dirName := "./testing/tmp/TestWatchedUpdatedConditionsIgnoreChmod.d"
+
+	watch, err := NewFileWatch()
+	if errors.Is(err, ErrWatchUnsupported) {
+		t.Skipf("file watching is not supported on this platform")
+	}
+
+	if err != nil {
+		t.Fatalf("Error: unable to create file watch; err=%v", err)
+	}
+	defer watch.Close()
+
+	_ = os.RemoveAll(dirName)
+	err = os.Mkdir(dirName, 0o755)
+	if err != nil {
+		t.Fatalf("Error: unable to create dirName=%s; err=%v", dirName, err)
+	}
+
+	err = os.WriteFile(fileName, []byte("version 1"), 0o644)
+	if err != nil {
+		t.Fatalf("Error: unable to write fileName=%s; err=%v", fileName, err)
+	}
+
+	conditions := []Condition{FileUpdatedCondition{FileName: fileName}, DirUpdatedCondition{DirName: dirName}}
+	for idx, condition := range conditions {
+		conditions[idx], err = condition.Init(ctx)
+		if err != nil {
+			t.Fatalf("Error: failed init %s; err=%v", Describe(condition), err)
+		}
+
+		conditions[idx], err = conditions[idx].(Watchable).Watch(ctx, watch)
+		if err != nil {
+			t.Fatalf("Error: failed to watch %s; err=%v", Describe(condition), err)
+		}
+	}
+
+	// NB: a chmod is an event, but it doesn't change the mtime
+	for _, path := range []string{fileName, dirName} {
+		err = os.Chmod(path, 0o700)
+		if err != nil {
+			t.Fatalf("Error: unable to chmod path=%s; err=%v", path, err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	for idx, condition := range conditions {
+		conditions[idx], res, err = condition.Check(ctx)
+		if err != nil || res {
+			t.Fatalf("Error: expected a chmod not to update %s, got res=%v err=%v", Describe(condition), res, err)
+		}
+	}
+
+	later := time.Now().Add(time.Minute)
+	err = os.Chtimes(fileName, later, later)
+	if err != nil {
+		t.Fatalf("Error: unable to touch fileName=%s; err=%v", fileName, err)
+	}
+
+	err = os.WriteFile(filepath.Join(dirName, "entry.txt"), nil, 0o644)
+	if err != nil {
+		t.Fatalf("Error: unable to add an entry to dirName=%s; err=%v", dirName, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	for idx, condition := range conditions {
+		conditions[idx], res, err = condition.Check(ctx)
+		if err != nil || !res {
+			t.Fatalf("Error: expected %s to have been updated, got res=%v err=%v", Describe(condition), res, err)
+		}
+	}
+
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatalf("Error: unable to stat fileName=%s; err=%v", fileName, err)
+	}
+
+	details := conditions[0].(Detailer).Details()
+	if details["changed_by"] != "mtime" || details["mtime"] != fileInfo.ModTime().Format(time.RFC3339Nano) {
+		t.Fatalf("Error: expected the current mtime to be reported, got details=%v", details)
+	}
+}
+
+func TestFileUpdatedConditionDetect(t *testing.T) {
+	var err error
+	var res bool
+	ctx := &Context{}
+	fileName := "./testing/tmp/TestFileUpdatedConditionDetect.txt"
+	err = os.WriteFile(fileName, []byte("version 1"), 0o644)
+	if err != nil {
+		t.Fatalf("Error: unable to write fileName=%s; err=%v", fileName, err)
+	}
+
+	byMtime := Condition(FileUpdatedCondition{FileName: fileName})
+	byContents := Condition(FileUpdatedCondition{FileName: fileName, Detect: DetectSize | DetectHash})
+	byMtime, err = byMtime.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init FileUpdatedCondition; err=%v", err)
+	}
+
+	byContents, err = byContents.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init FileUpdatedCondition; err=%v", err)
+	}
+
+	// NB: like touch
+	later := time.Now().Add(time.Minute)
+	err = os.Chtimes(fileName, later, later)
+	if err != nil {
+		t.Fatalf("Error: unable to touch fileName=%s; err=%v", fileName, err)
+	}
+
+	byContents, res, err = byContents.Check(ctx)
+	if err != nil || res {
+		t.Fatalf("Error: expected touch not to change the size or hash, got res=%v err=%v", res, err)
+	}
+
+	byMtime, res, err = byMtime.Check(ctx)
+	if err != nil || !res {
+		t.Fatalf("Error: expected touch to change the mtime, got res=%v err=%v", res, err)
+	}
+
+	if changedBy := byMtime.(Detailer).Details()["changed_by"]; changedBy != "mtime" {
+		t.Fatalf("Error: expected changed_by=mtime, got %s", changedBy)
+	}
+
+	// NB: like rsync -t, same size and mtime
+	err = os.WriteFile(fileName, []byte("version 2"), 0o644)
+	if err != nil {
+		t.Fatalf("Error: unable to write fileName=%s; err=%v", fileName, err)
+	}
+
+	err = os.Chtimes(fileName, later, later)
+	if err != nil {
+		t.Fatalf("Error: unable to preserve the mtime of fileName=%s; err=%v", fileName, err)
+	}
+
+	byContents, res, err = byContents.Check(ctx)
+	if err != nil || !res {
+		t.Fatalf("Error: expected the hash to change, got res=%v err=%v", res, err)
+	}
+
+	details := byContents.(Detailer).Details()
+	if details["changed_by"] != "hash" || details["detect"] != "size,hash" || details["sha256"] == "" {
+		t.Fatalf("Error: expected changed_by=hash, got details=%v", details)
+	}
+
+	_, err = ParseDetectMode([]string{"size", "ctime"})
+	if err == nil {
+		t.Fatalf("Error: expected ParseDetectMode to reject ctime")
+	}
+}
+
+func TestCommandSucceedsConditionRetries(t *testing.T) {
+	ctx := &Context{}
+	counter := "./testing/tmp/TestCommandSucceedsConditionRetries.count"
+	os.Remove(counter)
+
+	// NB: fails the first two times, with some output, then succeeds
+	command := fmt.Sprintf("echo x >> %s; n=$(wc -l < %s); echo attempt $n; test $n -ge 3", counter, counter)
+	var condition Condition = CommandSucceedsCondition{CommandStr: command, Quiet: true}
+	condition, err := condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init CommandSucceedsCondition; err=%v", err)
+	}
+
+	var res bool
+	for attempt := range 3 {
+		condition, res, err = condition.Check(ctx)
+		if err != nil {
+			t.Fatalf("Error: expected a failed attempt not to be an error, got err=%v", err)
+		}
+
+		if res != (attempt == 2) {
+			t.Fatalf("Error: expected attempt %d to have res=%v, got %v", attempt+1, attempt == 2, res)
+		}
+	}
+
+	details := condition.(Detailer).Details()
+	if details["attempts"] != "3" || details["exit_code"] != "0" || details["last_failure"] != "exited with code 1" || details["last_failure_output"] != "attempt 2" {
+		t.Fatalf("Error: unexpected details=%v", details)
+	}
+
+	condition = CommandSucceedsCondition{CommandStr: "sleep 5", MaxAttempts: 2, AttemptTimeout: 100 * time.Millisecond, Quiet: true}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init CommandSucceedsCondition; err=%v", err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || res {
+		t.Fatalf("Error: expected the first attempt to time out, got res=%v err=%v", res, err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err == nil || res {
+		t.Fatalf("Error: expected to give up after 2 attempts, got res=%v err=%v", res, err)
+	}
+
+	details = condition.(Detailer).Details()
+	if details["attempts"] != "2" || details["last_failure"] != "timed out after 100ms" {
+		t.Fatalf("Error: unexpected details=%v", details)
+	}
+}
+
+func TestCommandFailsCondition(t *testing.T) {
+	var err error
+	var res bool
+	ctx := &Context{}
+	var condition Condition = CommandFailsCondition{CommandStr: "true", Quiet: true}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init CommandFailsCondition; err=%v", err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || res {
+		t.Fatalf("Error: expected CommandFailsCondition to keep waiting while the command succeeds, got res=%v err=%v", res, err)
+	}
+
+	condition = CommandFailsCondition{CommandStr: "echo unhealthy; exit 3", Quiet: true}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init CommandFailsCondition; err=%v", err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || !res {
+		t.Fatalf("Error: expected CommandFailsCondition on the first failure, got res=%v err=%v", res, err)
+	}
+
+	details := condition.(Detailer).Details()
+	if details["exit_code"] != "3" || details["tail"] != "unhealthy" || details["attempts"] != "1" {
+		t.Fatalf("Error: unexpected details=%v", details)
+	}
+}
+
+func TestCommandFailsConditionExitCode(t *testing.T) {
+	var err error
+	var res bool
+	ctx := &Context{}
+	exitCode := 2
+	counter := "./testing/tmp/TestCommandFailsConditionExitCode.count"
+	os.Remove(counter)
+
+	// NB: exits 1 the first time, 2 after that
+	command := fmt.Sprintf("echo x >> %s; test $(wc -l < %s) -eq 1 && exit 1; exit 2", counter, counter)
+	var condition Condition = CommandFailsCondition{CommandStr: command, ExitCode: &exitCode, Quiet: true}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init CommandFailsCondition; err=%v", err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || res {
+		t.Fatalf("Error: expected exit code 1 not to count with ExitCode=2, got res=%v err=%v", res, err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || !res {
+		t.Fatalf("Error: expected exit code 2 to count with ExitCode=2, got res=%v err=%v", res, err)
+	}
+}
+
+func TestCommandFailsConditionConsecutive(t *testing.T) {
+	var err error
+	var res bool
+	ctx := &Context{}
+	counter := "./testing/tmp/TestCommandFailsConditionConsecutive.count"
+	os.Remove(counter)
+
+	// NB: fails, succeeds, then fails from then on
+	command := fmt.Sprintf("echo x >> %s; test $(wc -l < %s) -eq 2", counter, counter)
+	var condition Condition = CommandFailsCondition{CommandStr: command, Consecutive: 2, Quiet: true}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init CommandFailsCondition; err=%v", err)
+	}
+
+	for attempt, expected := range []bool{false, false, false, true} {
+		condition, res, err = condition.Check(ctx)
+		if err != nil || res != expected {
+			t.Fatalf("Error: expected attempt %d to have res=%v, got res=%v err=%v", attempt+1, expected, res, err)
+		}
+	}
+
+	details := condition.(Detailer).Details()
+	if details["attempts"] != "4" || details["consecutive_failures"] != "2" {
+		t.Fatalf("Error: unexpected details=%v", details)
+	}
+
+	condition = CommandFailsCondition{CommandStr: "sleep 5", AttemptTimeout: 100 * time.Millisecond, Quiet: true}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init CommandFailsCondition; err=%v", err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || !res {
+		t.Fatalf("Error: expected a timed out run to count as a failure, got res=%v err=%v", res, err)
+	}
+
+	if result := condition.(Detailer).Details()["result"]; result != "timed out after 100ms" {
+		t.Fatalf("Error: expected result=timed out after 100ms, got %s", result)
+	}
+}
+
+func TestParseExitExpectation(t *testing.T) {
+	expect, err := ParseExitExpectation([]string{"0", "3-5"}, []string{"KILL", "15"})
+	if err != nil {
+		t.Fatalf("Error: failed to parse the expectation; err=%v", err)
+	}
+
+	tests := []struct {
+		status   *ExitStatus
+		expected bool
+	}{
+		{&ExitStatus{Code: 0}, true},
+		{&ExitStatus{Code: 1}, false},
+		{&ExitStatus{Code: 4}, true},
+		{&ExitStatus{Code: -1, Signal: syscall.SIGKILL}, true},
+		{&ExitStatus{Code: -1, Signal: syscall.SIGTERM}, true},
+		{&ExitStatus{Code: -1, Signal: syscall.SIGINT}, false},
+		{nil, false},
+	}
+
+	for _, test := range tests {
+		if expect.Matches(test.status) != test.expected {
+			t.Fatalf("Error: expected %s to match status=%v: %v", expect, test.status, test.expected)
+		}
+	}
+
+	var unexpectedErr *UnexpectedExitError
+	var unknownErr *UnknownExitError
+	if !errors.As(expect.Check("pid 1", &ExitStatus{Code: 1}), &unexpectedErr) || !errors.As(expect.Check("pid 1", nil), &unknownErr) {
+		t.Fatalf("Error: expected exit 1 to be unexpected, and an unknown status to be unknown")
+	}
+
+	if expect.String() != "exit 0 or exit 3-5 or signal SIGKILL or signal SIGTERM" {
+		t.Fatalf("Error: unexpected description %s", expect)
+	}
+
+	for _, codes := range []string{"x", "5-3", "-1", "256"} {
+		_, err = ParseExitExpectation([]string{codes}, nil)
+		if err == nil {
+			t.Fatalf("Error: expected --expect-exit=%s to be rejected", codes)
+		}
+	}
+
+	expect, err = ParseExitExpectation(nil, nil)
+	if err != nil || expect != nil {
+		t.Fatalf("Error: expected no expectation, got %v; err=%v", expect, err)
+	}
+}
+
+func TestUnexpectedExitNotifiesFailure(t *testing.T) {
+	var err error
+	notifyLog := "./testing/tmp/TestUnexpectedExitNotifiesFailure.log"
+	err = SetupEnsureFileDoesNotExist(t, notifyLog)
+	if err != nil {
+		t.Fatalf("Error: unable to ensure file does not exist: fname=%s; err=%v", notifyLog, err)
+	}
+
+	ctx := &Context{
+		SuccessNotifiers: []Notification{CommandNotification{Command: "echo success >> " + notifyLog}},
+		FailureNotifiers: []Notification{CommandNotification{Command: `echo "failure $TMW_OUTCOME $TMW_EXIT_CODE" >> ` + notifyLog}},
+		ErrorNotifiers:   []Notification{CommandNotification{Command: "echo error >> " + notifyLog}},
+	}
+
+	expectSuccess, _ := ParseExitExpectation([]string{"0"}, nil)
+	err = ctx.WaitForCondition(CommandExitedCondition{CommandStr: "exit 3", Expect: expectSuccess})
+	var unexpectedErr *UnexpectedExitError
+	if !errors.As(err, &unexpectedErr) || ExitCodeForError(err) != ExitUnexpectedExit {
+		t.Fatalf("Error: expected an UnexpectedExitError with exit code %d, got err=%v", ExitUnexpectedExit, err)
+	}
+
+	expectKilled, _ := ParseExitExpectation(nil, []string{"SIGKILL"})
+	err = ctx.WaitForCondition(CommandExitedCondition{CommandStr: "kill -KILL $$", Expect: expectKilled})
+	if err != nil {
+		t.Fatalf("Error: expected being killed by SIGKILL to succeed, got err=%v", err)
+	}
+
+	// NB: exiting 0 isn't what was hoped for, but it mustn't read as success
+	expectFailure, _ := ParseExitExpectation([]string{"1-125"}, nil)
+	err = ctx.WaitForCondition(CommandExitedCondition{CommandStr: "true", Expect: expectFailure})
+	if ExitCodeForError(err) != ExitUnexpectedExit {
+		t.Fatalf("Error: expected exit code %d, got %d; err=%v", ExitUnexpectedExit, ExitCodeForError(err), err)
+	}
+
+	contents, err := os.ReadFile(notifyLog)
+	if err != nil || string(contents) != "failure failed 3\nsuccess\nfailure failed 0\n" {
+		t.Fatalf("Error: expected the failure and success notifiers to be run, got=%q; err=%v", contents, err)
+	}
+}
+
+func TestCompositeConditionUnexpected(t *testing.T) {
+	var err error
+	expectSuccess, _ := ParseExitExpectation([]string{"0"}, nil)
+	ctx := &Context{}
+
+	err = ctx.WaitForCondition(CompositeCondition{
+		Mode: CompositeAllOf,
+		Children: []Condition{
+			CommandExitedCondition{CommandStr: "true", Expect: expectSuccess},
+			CommandExitedCondition{CommandStr: "exit 4", Expect: expectSuccess},
+		},
+	})
+	var unexpectedErr *UnexpectedExitError
+	if !errors.As(err, &unexpectedErr) || unexpectedErr.Status.Code != 4 || ExitCodeForError(err) != ExitUnexpectedExit {
+		t.Fatalf("Error: expected an UnexpectedExitError for exit code 4, got err=%v", err)
+	}
+
+	// NB: a child that wasn't met isn't held against the any-of
+	err = ctx.WaitForCondition(CompositeCondition{
+		Mode: CompositeAnyOf,
+		Children: []Condition{
+			CommandExitedCondition{CommandStr: "true", Expect: expectSuccess},
+			CommandExitedCondition{CommandStr: "sleep 5; exit 4", Expect: expectSuccess},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error: expected the any-of to succeed; err=%v", err)
+	}
+}
+
+func TestProcMatcher(t *testing.T) {
+	proc := ProcInfo{Pid: os.Getpid() + 1, PPid: 1, Uid: 1000, Name: "postgres", Cmdline: "/usr/lib/postgresql/bin/postgres -D /var/lib/postgres"}
+	tests := []struct {
+		pattern  string
+		full     bool
+		userName string
+		ppid     int
+		expected bool
+	}{
+		{"^postgres$", false, "", 0, true},
+		{"^/usr/lib", false, "", 0, false},
+		{"^/usr/lib", true, "", 0, true},
+		{"postgres", false, "1000", 0, true},
+		{"postgres", false, "0", 0, false},
+		{"", false, "", 1, true},
+		{"", false, "", 2, false},
+	}
+
+	for _, test := range tests {
+		matcher, err := NewProcMatcher(test.pattern, test.full, test.userName, test.ppid)
+		if err != nil {
+			t.Fatalf("Error: failed to create the matcher for %+v; err=%v", test, err)
+		}
+
+		if matcher.Matches(proc) != test.expected {
+			t.Fatalf("Error: expected %+v to match %+v: %v", test, proc, test.expected)
+		}
+	}
+
+	proc.Pid = os.Getpid()
+	matcher, _ := NewProcMatcher("postgres", false, "", 0)
+	if matcher.Matches(proc) {
+		t.Fatalf("Error: expected tellmewhen itself never to match")
+	}
+
+	_, err := NewProcMatcher("", false, "", 0)
+	if err == nil {
+		t.Fatalf("Error: expected a matcher that matches everything to be rejected")
+	}
+}
+
+func TestProcExitedCondition(t *testing.T) {
+	var err error
+	var res bool
+	if runtime.GOOS != "linux" {
+		t.Skipf("processes are only listed from /proc on linux")
+	}
+
+	ctx := &Context{}
+	var cmds []*exec.Cmd
+	for _, seconds := range []string{"3600", "3601"} {
+		cmd := exec.Command("sleep", seconds)
+		err = cmd.Start()
+		if err != nil {
+			t.Fatalf("Error: unable to start sleep; err=%v", err)
+		}
+
+		defer cmd.Process.Kill()
+		cmds = append(cmds, cmd)
+	}
+
+	matcher, err := NewProcMatcher("^sleep 360[01]$", true, "", os.Getpid())
+	if err != nil {
+		t.Fatalf("Error: failed to create the matcher; err=%v", err)
+	}
+
+	var condition Condition = ProcExitedCondition{Matcher: matcher}
+	var started Condition = ProcStartedCondition{Matcher: matcher}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init ProcExitedCondition; err=%v", err)
+	}
+
+	started, res, err = started.Check(ctx)
+	if err != nil || !res || started.(Detailer).Details()["proc_count"] != "2" {
+		t.Fatalf("Error: expected ProcStartedCondition to see both sleeps, got res=%v err=%v", res, err)
+	}
+
+	for idx, cmd := range cmds {
+		condition, res, err = condition.Check(ctx)
+		if err != nil || res {
+			t.Fatalf("Error: expected %d sleep(s) to still be running, got res=%v err=%v", len(cmds)-idx, res, err)
+		}
+
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || !res {
+		t.Fatalf("Error: expected ProcExitedCondition once both sleeps exited, got res=%v err=%v", res, err)
+	}
+
+	if details := condition.(Detailer).Details(); details["proc_count"] != "2" || details["matched_count"] != "2" {
+		t.Fatalf("Error: unexpected details=%v", details)
+	}
+
+	// NB: with nothing left that matches, there's nothing to wait on
+	condition = ProcExitedCondition{Matcher: condition.(ProcExitedCondition).Matcher, Any: true}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init ProcExitedCondition when nothing matches; err=%v", err)
+	}
+
+	condition, res, err = condition.Check(ctx)
+	if err != nil || !res {
+		t.Fatalf("Error: expected ProcExitedCondition to be met when nothing matches, got res=%v err=%v", res, err)
+	}
+
+	if details := condition.(Detailer).Details(); details["matched_count"] != "0" {
+		t.Fatalf("Error: unexpected details=%v", details)
+	}
+}
+
+func TestCommandExitedConditionTree(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("process trees are only followed through /proc on linux")
+	}
+
+	var err error
+	var res bool
+	ctx := &Context{}
+	// NB: the sleep is orphaned straight away, it's only found because
+	// tellmewhen is its subreaper
+	var condition Condition = CommandExitedCondition{CommandStr: "( setsid sleep 1 </dev/null >/dev/null 2>&1 & )", Tree: true}
+	start := time.Now()
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init CommandExitedCondition; err=%v", err)
+	}
+
+	defer condition.(io.Closer).Close()
+
+	for !res && time.Since(start) < 10*time.Second {
+		condition, res, err = condition.Check(ctx)
+		if err != nil {
+			t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if !res || time.Since(start) < time.Second {
+		t.Fatalf("Error: expected CommandExitedCondition to wait for the orphaned sleep, got res=%v after %v", res, time.Since(start))
+	}
+
+	if descendants := condition.(Detailer).Details()["descendants"]; descendants == "0" {
+		t.Fatalf("Error: expected the sleep to be counted as a descendant, got %s", descendants)
+	}
+}
+
+func TestPidExitedConditionTree(t *testing.T) {
+	var err error
+	var res bool
+	if runtime.GOOS != "linux" {
+		t.Skipf("process trees are only followed through /proc on linux")
+	}
+
+	ctx := &Context{}
+	cmd := exec.Command("bash", "-c", "sleep 1 & sleep 0.3")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("Error: unable to start bash; err=%v", err)
+	}
+
+	defer cmd.Wait()
+
+	// NB: give bash a moment to start the background sleep
+	time.Sleep(100 * time.Millisecond)
+	var condition Condition = PidExitedCondition{Pid: cmd.Process.Pid, Tree: true}
+	condition, err = condition.Init(ctx)
+	if err != nil {
+		t.Fatalf("Error: failed init PidExitedCondition; err=%v", err)
+	}
+
+	defer condition.(io.Closer).Close()
+
+	sawPidExit := false
+	start := time.Now()
+	for !res && time.Since(start) < 10*time.Second {
+		condition, res, err = condition.Check(ctx)
+		if err != nil {
+			t.Fatalf("Error: failed to run condition.Check() err=%v", err)
+		}
+
+		sawPidExit = sawPidExit || condition.(PidExitedCondition).PidExited
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if !res || !sawPidExit || time.Since(start) < 800*time.Millisecond {
+		t.Fatalf("Error: expected PidExitedCondition to wait for the background sleep, got res=%v after %v", res, time.Since(start))
+	}
+
+	if descendants := condition.(Detailer).Details()["descendants"]; descendants != "2" {
+		t.Fatalf("Error: expected both sleeps to be counted as descendants, got %s", descendants)
+	}
+}
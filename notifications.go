@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// outcomes of a wait, as reported to notifications
+const (
+	OutcomeWaiting   = "waiting"
+	OutcomeSucceeded = "succeeded"
+	// the condition was met, but not the way it was expected to be
+	OutcomeFailed      = "failed"
+	OutcomeTimedOut    = "timeout"
+	OutcomeError       = "error"
+	OutcomeInterrupted = "interrupted"
+)
+
+const DefaultNotifyTimeout = 30 * time.Second
+
+/******************************************************************************/
+// Event describes the wait a notification is being sent for.
+type Event struct {
+	Condition   Condition
+	WaitingOn   WaitableThing
+	Target      string
+	Description string
+	Outcome     string
+	Details     map[string]string
+	Error       string
+	StartTime   time.Time
+	EndTime     time.Time
+	Hostname    string
+	// MessageTemplate is --message, when given it replaces the default
+	// message
+	MessageTemplate *template.Template
+}
+
+func NewEvent(condition Condition, start time.Time) Event {
+	hostname, _ := os.Hostname()
+	return Event{
+		Condition:   condition,
+		WaitingOn:   condition.WaitingOn(),
+		Target:      condition.Target(),
+		Description: Describe(condition),
+		StartTime:   start,
+		Hostname:    hostname,
+	}
+}
+
+// Update records the condition's latest state and the outcome of the
+// wait so far.
+func (self *Event) Update(condition Condition, outcome string) {
+	self.Condition = condition
+	self.Target = condition.Target()
+	self.Outcome = outcome
+	self.Error = ""
+	self.Details = nil
+	if detailer, ok := condition.(Detailer); ok {
+		self.Details = detailer.Details()
+	}
+
+	if self.Final() {
+		self.EndTime = time.Now()
+	}
+}
+
+func (self Event) Elapsed() time.Duration {
+	if self.EndTime.IsZero() {
+		return time.Since(self.StartTime)
+	}
+
+	return self.EndTime.Sub(self.StartTime)
+}
+
+// Final is false for the periodic "still waiting" progress notifications
+// sent by --notify-every, true once the wait is over.
+func (self Event) Final() bool {
+	return self.Outcome != OutcomeWaiting
+}
+
+func (self Event) Message() string {
+	if self.MessageTemplate == nil {
+		return self.DefaultMessage()
+	}
+
+	var rendered strings.Builder
+	err := self.MessageTemplate.Execute(&rendered, self.templateData())
+	if err != nil {
+		return fmt.Sprintf("%s (unable to render --message; err=%v)", self.DefaultMessage(), err)
+	}
+
+	return rendered.String()
+}
+
+func (self Event) DefaultMessage() string {
+	elapsed := self.Elapsed().Round(time.Second)
+	if !self.Final() {
+		return fmt.Sprintf("still waiting on %s, started at %s, running for %s so far",
+			self.Description, self.StartTime.Format(time.RFC3339), elapsed)
+	}
+
+	if self.Error != "" {
+		return fmt.Sprintf("%s: %s after %s (started at %s): %s",
+			self.Description, self.Outcome, elapsed, self.StartTime.Format(time.RFC3339), self.Error)
+	}
+
+	return fmt.Sprintf("%s: %s after %s (started at %s)",
+		self.Description, self.Outcome, elapsed, self.StartTime.Format(time.RFC3339))
+}
+
+// Environ returns the TMW_* environment variables describing the event,
+// they are passed to CommandNotification commands.
+func (self Event) Environ() []string {
+	environ := []string{
+		"TMW_WAIT_ON=" + self.WaitingOn.String(),
+		"TMW_TARGET=" + self.Target,
+		"TMW_DESCRIPTION=" + self.Description,
+		"TMW_OUTCOME=" + self.Outcome,
+		"TMW_FINAL=" + strconv.FormatBool(self.Final()),
+		"TMW_MESSAGE=" + self.Message(),
+		"TMW_STARTED=" + self.StartTime.Format(time.RFC3339),
+		"TMW_ELAPSED=" + self.Elapsed().Round(time.Millisecond).String(),
+		"TMW_ELAPSED_SECONDS=" + strconv.FormatFloat(self.Elapsed().Seconds(), 'f', 3, 64),
+		"TMW_HOSTNAME=" + self.Hostname,
+	}
+
+	if self.Error != "" {
+		environ = append(environ, "TMW_ERROR="+self.Error)
+	}
+
+	var keys []string
+	for key := range self.Details {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+	for _, key := range keys {
+		environ = append(environ, "TMW_"+strings.ToUpper(key)+"="+self.Details[key])
+	}
+
+	return environ
+}
+
+// EventPayload is the json document sent by HttpPostNotification
+type EventPayload struct {
+	WaitOn         string
+	Target         string
+	Description    string
+	Outcome        string
+	Final          bool
+	Message        string
+	Details        map[string]string `json:",omitempty"`
+	Error          string            `json:",omitempty"`
+	StartTime      time.Time
+	EndTime        time.Time
+	Elapsed        string
+	ElapsedSeconds float64
+	Hostname       string
+}
+
+func (self Event) Payload() EventPayload {
+	return EventPayload{
+		WaitOn:         self.WaitingOn.String(),
+		Target:         self.Target,
+		Description:    self.Description,
+		Outcome:        self.Outcome,
+		Final:          self.Final(),
+		Message:        self.Message(),
+		Details:        self.Details,
+		Error:          self.Error,
+		StartTime:      self.StartTime,
+		EndTime:        self.EndTime,
+		Elapsed:        self.Elapsed().Round(time.Millisecond).String(),
+		ElapsedSeconds: self.Elapsed().Seconds(),
+		Hostname:       self.Hostname,
+	}
+}
+
+/******************************************************************************/
+// NotifyAll sends every notification, one failing does not stop the rest
+// from being sent, all of the failures are returned.
+func NotifyAll(ctx *Context, notifications []Notification) error {
+	var errs []error
+	for idx, notification := range notifications {
+		var err error
+		notifications[idx], _, err = notification.Notify(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+/******************************************************************************/
+// CommandNotification runs Command via bash, Command is rendered as a
+// template first.
+type CommandNotification struct {
+	Command string
+}
+
+func (self CommandNotification) Notify(ctx *Context) (Notification, bool, error) {
+	command, err := RenderTemplate("notify-by-running", self.Command, ctx.Event)
+	if err != nil {
+		return self, false, fmt.Errorf("CommandNotification: error rendering '%s'; err=%w", self.Command, err)
+	}
+
+	cmd := exec.CommandContext(ctx.Context(), "bash", "-c", command)
+	cmd.Env = append(os.Environ(), ctx.Event.Environ()...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return self, false, fmt.Errorf("CommandNotification: error executing '%s'; err=%w", command, err)
+	}
+
+	return self, true, nil
+}
+
+/******************************************************************************/
+func notifyHttp(ctx *Context, method, url string, body []byte) error {
+	url, err := RenderTemplate("notify-url", url, ctx.Event)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx.Context(), method, url, reader)
+	if err != nil {
+		return err
+	}
+
+	// NB: a --notify-url-body template isn't necessarily json
+	if body != nil && json.Valid(body) {
+		req.Header.Set("Content-Type", "application/json")
+	} else if body != nil {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	client := &http.Client{Timeout: DefaultNotifyTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if ctx.Verbose {
+		fmt.Printf("notifyHttp: %s %s status=%d\n", method, url, resp.StatusCode)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s responded with status=%d", method, url, resp.StatusCode)
+	}
+
+	return nil
+}
+
+type HttpGetNotification struct {
+	Url string
+}
+
+func (self HttpGetNotification) Notify(ctx *Context) (Notification, bool, error) {
+	err := notifyHttp(ctx, http.MethodGet, self.Url, nil)
+	if err != nil {
+		return self, false, fmt.Errorf("HttpGetNotification: %w", err)
+	}
+
+	return self, true, nil
+}
+
+// HttpPostNotification posts the event's json Payload to Url, or Body
+// rendered as a template when it's given.
+type HttpPostNotification struct {
+	Url  string
+	Body string
+}
+
+func (self HttpPostNotification) Notify(ctx *Context) (Notification, bool, error) {
+	var body []byte
+	var err error
+	if self.Body == "" {
+		body, err = json.Marshal(ctx.Event.Payload())
+	} else {
+		var rendered string
+		rendered, err = RenderTemplate("notify-url-body", self.Body, ctx.Event)
+		body = []byte(rendered)
+	}
+
+	if err != nil {
+		return self, false, fmt.Errorf("HttpPostNotification: %w", err)
+	}
+
+	err = notifyHttp(ctx, http.MethodPost, self.Url, body)
+	if err != nil {
+		return self, false, fmt.Errorf("HttpPostNotification: %w", err)
+	}
+
+	return self, true, nil
+}
+
+/******************************************************************************/
+// NewNotification checks that target parses as a template up front, so
+// that mistakes aren't only found once the wait is over.
+func NewNotification(notificationType NotificationType, target string) (Notification, error) {
+	_, err := ParseTemplate(notificationType.String(), target)
+	if err != nil {
+		return nil, err
+	}
+
+	switch notificationType {
+	case NotifyViaCommand:
+		return CommandNotification{Command: target}, nil
+	case NotifyViaHttpGet:
+		return HttpGetNotification{Url: target}, nil
+	case NotifyViaHttpPost:
+		return HttpPostNotification{Url: target}, nil
+	}
+
+	return nil, fmt.Errorf("unrecognized notification type: %s", notificationType)
+}
+
+func CommandNotifications(commands []string) ([]Notification, error) {
+	var notifications []Notification
+	for _, command := range commands {
+		notification, err := NewNotification(NotifyViaCommand, command)
+		if err != nil {
+			return nil, err
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, nil
+}
+
+// UrlNotifications requests each of urls with notificationType, a POST of
+// body rendered as a template instead of the json when body is given.
+func UrlNotifications(urls []string, notificationType NotificationType, body string) ([]Notification, error) {
+	var notifications []Notification
+	for _, url := range urls {
+		notification, err := NewNotification(notificationType, url)
+		if err != nil {
+			return nil, err
+		}
+
+		if body != "" {
+			notification = HttpPostNotification{Url: url, Body: body}
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, nil
+}
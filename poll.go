@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+/******************************************************************************/
+// PollPolicy controls how long WaitForCondition sleeps between checks:
+// it starts at Interval and is multiplied by BackoffFactor after every
+// check, up to MaxInterval. Jitter randomizes each sleep by up to that
+// fraction of the interval (0.1 => +/-10%).
+type PollPolicy struct {
+	Interval      time.Duration
+	MaxInterval   time.Duration
+	BackoffFactor float64
+	Jitter        float64
+}
+
+var DefaultPollPolicy = PollPolicy{
+	Interval:      100 * time.Millisecond,
+	MaxInterval:   30 * time.Second,
+	BackoffFactor: 1.0,
+	Jitter:        0.0,
+}
+
+// Conditions that are expensive to check (fork a process, make a network
+// call) implement Pacer to suggest their own default poll policy. Jitter
+// is left to the user, a zero Jitter means none.
+type Pacer interface {
+	PollPolicy() PollPolicy
+}
+
+func (self PollPolicy) Validate() error {
+	if self.Interval < 0 || self.MaxInterval < 0 {
+		return fmt.Errorf("poll intervals must not be negative: --interval=%s --max-interval=%s", self.Interval, self.MaxInterval)
+	}
+
+	if self.BackoffFactor != 0 && self.BackoffFactor < 1.0 {
+		return fmt.Errorf("--backoff-factor must be >= 1.0, got %v", self.BackoffFactor)
+	}
+
+	if self.Jitter < 0 || self.Jitter > 1.0 {
+		return fmt.Errorf("--jitter must be between 0.0 and 1.0, got %v", self.Jitter)
+	}
+
+	return nil
+}
+
+// Merge returns self with any zero valued fields taken from defaults.
+func (self PollPolicy) Merge(defaults PollPolicy) PollPolicy {
+	if self.Interval == 0 {
+		self.Interval = defaults.Interval
+	}
+
+	if self.MaxInterval == 0 {
+		self.MaxInterval = defaults.MaxInterval
+	}
+
+	if self.BackoffFactor == 0 {
+		self.BackoffFactor = defaults.BackoffFactor
+	}
+
+	if self.Jitter == 0 {
+		self.Jitter = defaults.Jitter
+	}
+
+	// NB: an --interval larger than the (possibly default) max interval
+	// would otherwise be silently clamped on the very first sleep
+	if self.MaxInterval < self.Interval {
+		self.MaxInterval = self.Interval
+	}
+
+	return self
+}
+
+// PollPolicyFor resolves the poll policy for condition: options given on
+// the command line win, then the condition's suggestion, then the
+// defaults.
+func PollPolicyFor(overrides PollPolicy, condition Condition) PollPolicy {
+	suggested := DefaultPollPolicy
+	if pacer, ok := condition.(Pacer); ok {
+		suggested = pacer.PollPolicy().Merge(DefaultPollPolicy)
+	}
+
+	return overrides.Merge(suggested)
+}
+
+/******************************************************************************/
+type Poller struct {
+	Policy  PollPolicy
+	Current time.Duration
+}
+
+func NewPoller(policy PollPolicy) *Poller {
+	return &Poller{Policy: policy, Current: policy.Interval}
+}
+
+// Next returns how long to sleep before the next check and backs off the
+// interval for the one after that.
+func (self *Poller) Next() time.Duration {
+	sleepFor := self.Current
+	if self.Policy.Jitter > 0 {
+		spread := float64(sleepFor) * self.Policy.Jitter
+		sleepFor += time.Duration(spread * (2*rand.Float64() - 1))
+	}
+
+	next := time.Duration(float64(self.Current) * self.Policy.BackoffFactor)
+	self.Current = min(next, self.Policy.MaxInterval)
+
+	return sleepFor
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ExitStatus is how a process ended, when that could be found out.
+type ExitStatus struct {
+	Code   int
+	Signal syscall.Signal
+}
+
+func NewExitStatus(waitStatus syscall.WaitStatus) ExitStatus {
+	if waitStatus.Signaled() {
+		return ExitStatus{Code: -1, Signal: waitStatus.Signal()}
+	}
+
+	return ExitStatus{Code: waitStatus.ExitStatus()}
+}
+
+// CommandExitStatus turns the result of exec.Cmd.Wait into an
+// ExitStatus, a non-zero exit is not an error, failing to wait is.
+func CommandExitStatus(err error) (ExitStatus, error) {
+	if err == nil {
+		return ExitStatus{Code: 0}, nil
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return ExitStatus{}, err
+	}
+
+	waitStatus, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return ExitStatus{Code: exitErr.ExitCode()}, nil
+	}
+
+	return NewExitStatus(waitStatus), nil
+}
+
+func (self ExitStatus) String() string {
+	if self.Signal != 0 {
+		return fmt.Sprintf("killed by signal %d (%s)", int(self.Signal), self.Signal)
+	}
+
+	return fmt.Sprintf("exited with code %d", self.Code)
+}
+
+func (self ExitStatus) Details() map[string]string {
+	details := map[string]string{
+		"exit_code":   strconv.Itoa(self.Code),
+		"exit_status": self.String(),
+	}
+
+	if self.Signal != 0 {
+		details["exit_signal"] = strconv.Itoa(int(self.Signal))
+	}
+
+	return details
+}
+
+/******************************************************************************/
+// the signals --expect-signal knows by name, others can be given by number
+var StringToSignalTable = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGILL":  syscall.SIGILL,
+	"SIGTRAP": syscall.SIGTRAP,
+	"SIGABRT": syscall.SIGABRT,
+	"SIGBUS":  syscall.SIGBUS,
+	"SIGFPE":  syscall.SIGFPE,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGSEGV": syscall.SIGSEGV,
+	"SIGPIPE": syscall.SIGPIPE,
+	"SIGALRM": syscall.SIGALRM,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// ParseSignal parses eg: SIGKILL, KILL or 9.
+func ParseSignal(str string) (syscall.Signal, error) {
+	number, err := strconv.Atoi(str)
+	if err == nil && number > 0 {
+		return syscall.Signal(number), nil
+	}
+
+	name := strings.ToUpper(str)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	signal, ok := StringToSignalTable[name]
+	if !ok {
+		return 0, fmt.Errorf("unrecognized signal '%s'", str)
+	}
+
+	return signal, nil
+}
+
+func SignalName(signal syscall.Signal) string {
+	for name, known := range StringToSignalTable {
+		if known == signal {
+			return name
+		}
+	}
+
+	return strconv.Itoa(int(signal))
+}
+
+type ExitCodeRange struct {
+	From int
+	To   int
+}
+
+// ExitExpectation is how a process is hoped to end (--expect-exit and
+// --expect-signal), exiting with any one of Codes or being killed by any
+// one of Signals meets it.
+type ExitExpectation struct {
+	Codes   []ExitCodeRange
+	Signals []syscall.Signal
+}
+
+// ParseExitExpectation parses codes like 0 or 1-125 and signals like
+// SIGKILL, it returns nil when there are neither.
+func ParseExitExpectation(codes []string, signals []string) (*ExitExpectation, error) {
+	if len(codes) == 0 && len(signals) == 0 {
+		return nil, nil
+	}
+
+	var expect ExitExpectation
+	for _, code := range codes {
+		from, to, isRange := strings.Cut(code, "-")
+		if !isRange {
+			to = from
+		}
+
+		fromCode, fromErr := strconv.Atoi(from)
+		toCode, toErr := strconv.Atoi(to)
+		if fromErr != nil || toErr != nil || fromCode < 0 || toCode > 255 || fromCode > toCode {
+			return nil, fmt.Errorf("invalid exit code '%s', expected eg: 0 or 1-125", code)
+		}
+
+		expect.Codes = append(expect.Codes, ExitCodeRange{From: fromCode, To: toCode})
+	}
+
+	for _, name := range signals {
+		signal, err := ParseSignal(name)
+		if err != nil {
+			return nil, err
+		}
+
+		expect.Signals = append(expect.Signals, signal)
+	}
+
+	return &expect, nil
+}
+
+func (self *ExitExpectation) Matches(status *ExitStatus) bool {
+	if status == nil {
+		return false
+	}
+
+	if status.Signal != 0 {
+		return slices.Contains(self.Signals, status.Signal)
+	}
+
+	return slices.ContainsFunc(self.Codes, func(codes ExitCodeRange) bool {
+		return codes.From <= status.Code && status.Code <= codes.To
+	})
+}
+
+func (self *ExitExpectation) String() string {
+	var expected []string
+	for _, codes := range self.Codes {
+		if codes.From == codes.To {
+			expected = append(expected, fmt.Sprintf("exit %d", codes.From))
+		} else {
+			expected = append(expected, fmt.Sprintf("exit %d-%d", codes.From, codes.To))
+		}
+	}
+
+	for _, signal := range self.Signals {
+		expected = append(expected, "signal "+SignalName(signal))
+	}
+
+	return strings.Join(expected, " or ")
+}
+
+// Check returns an UnexpectedExitError when status doesn't meet the
+// expectation, an UnknownExitError when there's no status to check; a nil
+// expectation is met by anything.
+func (self *ExitExpectation) Check(description string, status *ExitStatus) error {
+	if self == nil || self.Matches(status) {
+		return nil
+	}
+
+	if status == nil {
+		return &UnknownExitError{Description: description, Expected: self.String()}
+	}
+
+	return &UnexpectedExitError{Description: description, Status: status, Expected: self.String()}
+}
+
+/******************************************************************************/
+// how long a command is given to exit after being signalled, before its
+// process group is killed
+const KillGracePeriod = 10 * time.Second
+
+// InterruptSignal is the signal that interrupted the wait, it's what is
+// forwarded to the commands tellmewhen started; SIGTERM when the wait
+// ended some other way (eg: a --timeout).
+func InterruptSignal(ctx context.Context) os.Signal {
+	var interruptedErr *InterruptedError
+	if errors.As(context.Cause(ctx), &interruptedErr) {
+		return interruptedErr.Signal
+	}
+
+	return syscall.SIGTERM
+}
+
+// ProbeCommand runs command via bash in a process group of its own, the
+// group is signalled when ctx is done.
+func ProbeCommand(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	SetProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return SignalProcessGroup(cmd, InterruptSignal(ctx))
+	}
+	cmd.WaitDelay = KillGracePeriod
+	return cmd
+}
+
+// ForwardInterrupt signals cmd's process group if ctx is done before
+// the command is.
+func ForwardInterrupt(ctx context.Context, cmd *exec.Cmd, done <-chan struct{}) {
+	select {
+	case <-ctx.Done():
+		err := SignalProcessGroup(cmd, InterruptSignal(ctx))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ForwardInterrupt: unable to signal pid=%d; err=%v\n", cmd.Process.Pid, err)
+		}
+	case <-done:
+	}
+}
+
+/******************************************************************************/
+// ProbeResult is how one run of a probe command (process-succeeds,
+// process-fails) went.
+type ProbeResult struct {
+	Status   ExitStatus
+	TimedOut bool
+	Timeout  time.Duration
+	Duration time.Duration
+	Output   []string
+}
+
+func (self ProbeResult) Succeeded() bool {
+	return !self.TimedOut && self.Status.Code == 0 && self.Status.Signal == 0
+}
+
+func (self ProbeResult) String() string {
+	if self.TimedOut {
+		return fmt.Sprintf("timed out after %v", self.Timeout)
+	}
+
+	return self.Status.String()
+}
+
+// RunProbe runs command once, giving up on it after timeout when that's
+// set. Its output is passed through unless quiet, the last tailLines
+// lines are kept either way. A non-zero exit or a timeout is not an
+// error, the command not running at all or ctx being done is.
+func RunProbe(ctx context.Context, command string, timeout time.Duration, quiet bool, tailLines int) (ProbeResult, error) {
+	probeCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		probeCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	output := NewTailBuffer(tailLines)
+	cmd := ProbeCommand(probeCtx, command)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if !quiet {
+		cmd.Stdout = io.MultiWriter(os.Stdout, output)
+		cmd.Stderr = io.MultiWriter(os.Stderr, output)
+	}
+
+	start := time.Now()
+	err := cmd.Run()
+	result := ProbeResult{Timeout: timeout, Duration: time.Since(start), Output: output.Tail()}
+	if ctx.Err() != nil {
+		return result, context.Cause(ctx)
+	}
+
+	if probeCtx.Err() != nil {
+		result.TimedOut = true
+		return result, nil
+	}
+
+	result.Status, err = CommandExitStatus(err)
+	return result, err
+}
+
+// launched are the pids of the commands tellmewhen started and waits on
+// itself, they're its children but never orphans (see ProcTree)
+var launched sync.Map
+
+func AddLaunched(pid int) {
+	launched.Store(pid, true)
+}
+
+func RemoveLaunched(pid int) {
+	launched.Delete(pid)
+}
+
+func IsLaunched(pid int) bool {
+	_, ok := launched.Load(pid)
+	return ok
+}
+
+/******************************************************************************/
+const DefaultTailLines = 20
+
+// a line this long without a newline is kept as if it had ended
+const MaxTailLineBytes = 64 * 1024
+
+// TailBuffer keeps the last Lines lines written to it, it's safe to
+// share between the goroutines copying a command's stdout and stderr.
+type TailBuffer struct {
+	Lines   int
+	mu      sync.Mutex
+	lines   []string
+	partial []byte
+}
+
+func NewTailBuffer(lines int) *TailBuffer {
+	return &TailBuffer{Lines: lines}
+}
+
+func (self *TailBuffer) Write(p []byte) (int, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.partial = append(self.partial, p...)
+	for {
+		idx := bytes.IndexByte(self.partial, '\n')
+		if idx < 0 {
+			break
+		}
+
+		self.push(string(self.partial[:idx]))
+		self.partial = self.partial[idx+1:]
+	}
+
+	if len(self.partial) > MaxTailLineBytes {
+		self.push(string(self.partial))
+		self.partial = nil
+	}
+
+	return len(p), nil
+}
+
+func (self *TailBuffer) push(line string) {
+	self.lines = append(self.lines, strings.TrimSuffix(line, "\r"))
+	if len(self.lines) > self.Lines {
+		self.lines = self.lines[len(self.lines)-self.Lines:]
+	}
+}
+
+// Tail returns the last Lines lines, including a final line that
+// hasn't been terminated yet.
+func (self *TailBuffer) Tail() []string {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	lines := slices.Clone(self.lines)
+	if len(self.partial) > 0 {
+		lines = append(lines, string(self.partial))
+	}
+
+	if len(lines) > self.Lines {
+		lines = lines[len(lines)-self.Lines:]
+	}
+
+	return lines
+}
+
+// WriteFile saves the tail to a temporary file and returns its name.
+func (self *TailBuffer) WriteFile() (string, error) {
+	file, err := os.CreateTemp("", "tellmewhen-tail-*.log")
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	for _, line := range self.Tail() {
+		_, err = fmt.Fprintln(file, line)
+		if err != nil {
+			os.Remove(file.Name())
+			return "", err
+		}
+	}
+
+	return file.Name(), nil
+}
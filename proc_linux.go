@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+)
+
+// from linux/prctl.h
+const prSetChildSubreaper = 36
+
+/******************************************************************************/
+// ProcStat is the subset of /proc/<pid>/stat that tellmewhen uses.
+type ProcStat struct {
+	Pid       int
+	Comm      string
+	State     byte
+	PPid      int
+	StartTime uint64
+	ExitCode  int
+}
+
+func ReadProcStat(pid int) (ProcStat, error) {
+	contents, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return ProcStat{}, err
+	}
+
+	return ParseProcStat(contents)
+}
+
+// ParseProcStat parses the contents of /proc/<pid>/stat, see proc(5). The
+// command name is in parens and may itself contain spaces and parens.
+func ParseProcStat(contents []byte) (ProcStat, error) {
+	open := bytes.IndexByte(contents, '(')
+	close := bytes.LastIndexByte(contents, ')')
+	if open < 0 || close < open {
+		return ProcStat{}, fmt.Errorf("unable to parse /proc/<pid>/stat: %q", contents)
+	}
+
+	var err error
+	stat := ProcStat{Comm: string(contents[open+1 : close])}
+	stat.Pid, err = strconv.Atoi(string(bytes.TrimSpace(contents[:open])))
+	if err != nil {
+		return stat, fmt.Errorf("unable to parse pid from /proc/<pid>/stat: %w", err)
+	}
+
+	// fields[0] is field 3 (state) in proc(5)'s numbering
+	fields := bytes.Fields(contents[close+1:])
+	if len(fields) < 20 {
+		return stat, fmt.Errorf("unable to parse /proc/%d/stat: too few fields", stat.Pid)
+	}
+
+	stat.State = fields[0][0]
+	stat.PPid, err = strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return stat, fmt.Errorf("unable to parse ppid from /proc/%d/stat: %w", stat.Pid, err)
+	}
+
+	stat.StartTime, err = strconv.ParseUint(string(fields[19]), 10, 64)
+	if err != nil {
+		return stat, fmt.Errorf("unable to parse starttime from /proc/%d/stat: %w", stat.Pid, err)
+	}
+
+	// NB: field 52 (exit_code) was added in linux 3.5
+	if len(fields) >= 50 {
+		stat.ExitCode, _ = strconv.Atoi(string(fields[49]))
+	}
+
+	return stat, nil
+}
+
+// PidStartTime is when pid started, in clock ticks since boot.
+func PidStartTime(pid int) (uint64, error) {
+	stat, err := ReadProcStat(pid)
+	return stat.StartTime, err
+}
+
+func (self ProcStat) IsZombie() bool {
+	return self.State == 'Z' || self.State == 'X'
+}
+
+/******************************************************************************/
+// PidState reports whether pid is still running. When startTime is not
+// zero a process with a different start time is a new process that reused
+// the pid, so the original has exited. The exit status is returned when
+// it can still be read from a zombie's /proc/<pid>/stat, once the parent
+// has reaped it there's no telling how it exited.
+func PidState(pid int, startTime uint64) (bool, *ExitStatus, error) {
+	stat, err := ReadProcStat(pid)
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		return false, nil, nil
+	}
+
+	if err != nil {
+		// no (readable) procfs, fall back to signals
+		alive, err := PidAlive(pid)
+		return alive, nil, err
+	}
+
+	if startTime != 0 && stat.StartTime != startTime {
+		return false, nil, nil
+	}
+
+	// NB: the kernel reports the exit_code of a process we may not ptrace
+	// as 0, so it's only trusted for our own processes
+	if stat.IsZombie() && ProcOwnedByUs(pid) {
+		status := NewExitStatus(syscall.WaitStatus(stat.ExitCode))
+		return false, &status, nil
+	} else if stat.IsZombie() {
+		return false, nil, nil
+	}
+
+	return true, nil, nil
+}
+
+// ProcOwnedByUs is true when we are root, or /proc/<pid> belongs to our
+// effective uid (it belongs to root for processes that aren't dumpable,
+// eg: setuid ones).
+func ProcOwnedByUs(pid int) bool {
+	if os.Geteuid() == 0 {
+		return true
+	}
+
+	info, err := os.Stat(fmt.Sprintf("/proc/%d", pid))
+	if err != nil {
+		return false
+	}
+
+	return int(info.Sys().(*syscall.Stat_t).Uid) == os.Geteuid()
+}
+
+// PidAlive sends signal 0 to pid, EPERM means the process exists but
+// belongs to someone else.
+func PidAlive(pid int) (bool, error) {
+	err := syscall.Kill(pid, syscall.Signal(0))
+	switch {
+	case err == nil, errors.Is(err, syscall.EPERM):
+		return true, nil
+	case errors.Is(err, syscall.ESRCH):
+		return false, nil
+	}
+
+	return false, err
+}
+
+/******************************************************************************/
+// ListProcs reads every process in /proc, ones that exit while it's
+// reading are left out.
+func ListProcs() ([]ProcInfo, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	var procs []ProcInfo
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		stat, err := ReadProcStat(pid)
+		if err != nil {
+			continue
+		}
+
+		info, err := os.Stat(fmt.Sprintf("/proc/%d", pid))
+		if err != nil {
+			continue
+		}
+
+		// NB: kernel threads have an empty cmdline, pgrep shows them by
+		// name so they're kept
+		cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+		if err != nil {
+			continue
+		}
+
+		procs = append(procs, ProcInfo{
+			Pid:       pid,
+			PPid:      stat.PPid,
+			Uid:       int(info.Sys().(*syscall.Stat_t).Uid),
+			Name:      stat.Comm,
+			Cmdline:   string(bytes.TrimRight(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '}), " ")),
+			StartTime: stat.StartTime,
+			Zombie:    stat.IsZombie(),
+		})
+	}
+
+	return procs, nil
+}
+
+// SetChildSubreaper makes tellmewhen the parent of the orphans of the
+// processes it starts, instead of init, see PR_SET_CHILD_SUBREAPER in
+// prctl(2).
+func SetChildSubreaper() error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0)
+	if errno != 0 {
+		return fmt.Errorf("prctl(PR_SET_CHILD_SUBREAPER): %w", errno)
+	}
+
+	return nil
+}
+
+// ReapOrphan waits for pid, an orphan that was reparented to tellmewhen
+// and has exited, so that it doesn't linger as a zombie.
+func ReapOrphan(pid int) {
+	var status syscall.WaitStatus
+	_, _ = syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+}
+
+/******************************************************************************/
+// PidWatch uses a pidfd to find out when a process exits without polling.
+type PidWatch struct {
+	file   *os.File
+	exited atomic.Bool
+	wake   chan struct{}
+}
+
+func NewPidWatch(pid int) (*PidWatch, error) {
+	fd, _, errno := syscall.Syscall(sysPidfdOpen, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("pidfd_open %d: %w", pid, errno)
+	}
+
+	err := syscall.SetNonblock(int(fd), true)
+	if err != nil {
+		syscall.Close(int(fd))
+		return nil, err
+	}
+
+	watch := &PidWatch{file: os.NewFile(fd, "pidfd"), wake: make(chan struct{}, 1)}
+	go watch.wait()
+	return watch, nil
+}
+
+func (self *PidWatch) wait() {
+	conn, err := self.file.SyscallConn()
+	if err != nil {
+		return
+	}
+
+	// NB: the pidfd becomes readable when the process exits, returning
+	// false the first time makes Read wait for that
+	ready := false
+	err = conn.Read(func(fd uintptr) bool {
+		done := ready
+		ready = true
+		return done
+	})
+	if err != nil {
+		return
+	}
+
+	self.exited.Store(true)
+	self.wake <- struct{}{}
+}
+
+func (self *PidWatch) Exited() bool {
+	return self.exited.Load()
+}
+
+func (self *PidWatch) Wake() <-chan struct{} {
+	return self.wake
+}
+
+func (self *PidWatch) Close() error {
+	return self.file.Close()
+}
@@ -0,0 +1,68 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+var ErrProcUnsupported = errors.New("process inspection is not supported on this platform")
+
+func PidStartTime(pid int) (uint64, error) {
+	return 0, ErrProcUnsupported
+}
+
+func PidState(pid int, startTime uint64) (bool, *ExitStatus, error) {
+	alive, err := PidAlive(pid)
+	return alive, nil, err
+}
+
+func ListProcs() ([]ProcInfo, error) {
+	return nil, ErrProcUnsupported
+}
+
+func SetChildSubreaper() error {
+	return ErrProcUnsupported
+}
+
+func ReapOrphan(pid int) {}
+
+// PidAlive sends signal 0 to pid, EPERM means the process exists but
+// belongs to someone else.
+func PidAlive(pid int) (bool, error) {
+	pinfo, err := os.FindProcess(pid)
+	if err != nil {
+		return false, nil
+	}
+
+	err = pinfo.Signal(syscall.Signal(0))
+	switch {
+	case err == nil, errors.Is(err, syscall.EPERM):
+		return true, nil
+	case errors.Is(err, os.ErrProcessDone), errors.Is(err, syscall.ESRCH):
+		return false, nil
+	}
+
+	return false, err
+}
+
+// PidWatch is only implemented on linux, elsewhere pids are polled.
+type PidWatch struct{}
+
+func NewPidWatch(pid int) (*PidWatch, error) {
+	return nil, ErrProcUnsupported
+}
+
+func (self *PidWatch) Exited() bool {
+	return false
+}
+
+func (self *PidWatch) Wake() <-chan struct{} {
+	return nil
+}
+
+func (self *PidWatch) Close() error {
+	return nil
+}
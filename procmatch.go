@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ProcInfo is what proc-exits and proc-started match processes on.
+type ProcInfo struct {
+	Pid       int
+	PPid      int
+	Uid       int
+	Name      string
+	Cmdline   string
+	StartTime uint64
+	Zombie    bool
+}
+
+/******************************************************************************/
+// ProcMatcher selects processes like pgrep: Pattern is matched against
+// the process name, or its whole command line when Full is set, Uid and
+// PPid must be equal when they're not -1. tellmewhen itself never
+// matches.
+type ProcMatcher struct {
+	Pattern *regexp.Regexp
+	Full    bool
+	Uid     int
+	PPid    int
+}
+
+// NewProcMatcher parses pattern and looks up userName (a name or a uid),
+// an empty pattern or userName and a ppid of 0 match anything.
+func NewProcMatcher(pattern string, full bool, userName string, ppid int) (ProcMatcher, error) {
+	matcher := ProcMatcher{Full: full, Uid: -1, PPid: -1}
+	if pattern == "" && userName == "" && ppid == 0 {
+		return matcher, fmt.Errorf("at least one of --match, --user or --parent is required")
+	}
+
+	if pattern != "" {
+		var err error
+		matcher.Pattern, err = regexp.Compile(pattern)
+		if err != nil {
+			return matcher, fmt.Errorf("invalid --match pattern: %w", err)
+		}
+	}
+
+	if userName != "" {
+		uid, err := LookupUid(userName)
+		if err != nil {
+			return matcher, err
+		}
+
+		matcher.Uid = uid
+	}
+
+	if ppid > 0 {
+		matcher.PPid = ppid
+	}
+
+	return matcher, nil
+}
+
+func LookupUid(userName string) (int, error) {
+	uid, err := strconv.Atoi(userName)
+	if err == nil {
+		return uid, nil
+	}
+
+	found, err := user.Lookup(userName)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(found.Uid)
+}
+
+func (self ProcMatcher) Matches(proc ProcInfo) bool {
+	if proc.Pid == os.Getpid() {
+		return false
+	}
+
+	if self.Uid >= 0 && proc.Uid != self.Uid {
+		return false
+	}
+
+	if self.PPid >= 0 && proc.PPid != self.PPid {
+		return false
+	}
+
+	if self.Pattern == nil {
+		return true
+	}
+
+	if self.Full && proc.Cmdline != "" {
+		return self.Pattern.MatchString(proc.Cmdline)
+	}
+
+	return self.Pattern.MatchString(proc.Name)
+}
+
+func (self ProcMatcher) String() string {
+	var parts []string
+	if self.Pattern != nil {
+		parts = append(parts, self.Pattern.String())
+	}
+
+	if self.Uid >= 0 {
+		parts = append(parts, fmt.Sprintf("uid=%d", self.Uid))
+	}
+
+	if self.PPid >= 0 {
+		parts = append(parts, fmt.Sprintf("ppid=%d", self.PPid))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// MatchProcs lists the processes that match.
+func (self ProcMatcher) MatchProcs() ([]ProcInfo, error) {
+	procs, err := ListProcs()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []ProcInfo
+	for _, proc := range procs {
+		if !proc.Zombie && self.Matches(proc) {
+			matched = append(matched, proc)
+		}
+	}
+
+	return matched, nil
+}
+
+// ProcDetails are the pids, names and command lines of procs, one per
+// line.
+func ProcDetails(procs []ProcInfo) map[string]string {
+	var pids, names, cmdlines []string
+	for _, proc := range procs {
+		pids = append(pids, strconv.Itoa(proc.Pid))
+		names = append(names, proc.Name)
+		cmdlines = append(cmdlines, proc.Cmdline)
+	}
+
+	return map[string]string{
+		"proc_count": strconv.Itoa(len(procs)),
+		"pids":       strings.Join(pids, "\n"),
+		"names":      strings.Join(names, "\n"),
+		"cmdlines":   strings.Join(cmdlines, "\n"),
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+)
+
+// ProcTree follows the descendants of Root through /proc, so that a wait
+// on a process can last until everything it started has exited too.
+// Descendants are found by their parent pid, once seen they're followed
+// even after being reparented (eg: a daemon that double forked). When
+// Subreaper is set tellmewhen is the subreaper of Root's descendants, the
+// orphans reparented to it are part of the tree too.
+//
+// NB: a process that starts and is orphaned between two scans is only
+// seen with Subreaper
+type ProcTree struct {
+	Root      int
+	Subreaper bool
+	// the descendants that are still running, by pid
+	Members map[int]ProcInfo
+	// how many descendants have been seen in all
+	Seen int
+}
+
+func NewProcTree(root int, subreaper bool) *ProcTree {
+	return &ProcTree{Root: root, Subreaper: subreaper, Members: map[int]ProcInfo{}}
+}
+
+// Scan refreshes Members, Root's own children are only looked for while
+// rootAlive since once it has exited its pid may be reused.
+func (self *ProcTree) Scan(rootAlive bool) error {
+	procs, err := ListProcs()
+	if err != nil {
+		return err
+	}
+
+	myPid := os.Getpid()
+	live := map[int]ProcInfo{}
+	children := map[int][]ProcInfo{}
+	var orphans []ProcInfo
+	for _, proc := range procs {
+		isOrphan := self.Subreaper && proc.PPid == myPid && proc.Pid != self.Root && !IsLaunched(proc.Pid)
+		if proc.Zombie {
+			if isOrphan {
+				ReapOrphan(proc.Pid)
+			}
+
+			continue
+		}
+
+		children[proc.PPid] = append(children[proc.PPid], proc)
+		member, known := self.Members[proc.Pid]
+		if known && member.StartTime == proc.StartTime {
+			live[proc.Pid] = proc
+		}
+
+		if isOrphan {
+			orphans = append(orphans, proc)
+		}
+	}
+
+	var queue []int
+	if rootAlive {
+		queue = append(queue, self.Root)
+	}
+
+	for pid := range live {
+		queue = append(queue, pid)
+	}
+
+	add := func(proc ProcInfo) {
+		if _, known := live[proc.Pid]; known || proc.Pid == self.Root {
+			return
+		}
+
+		live[proc.Pid] = proc
+		self.Seen++
+		queue = append(queue, proc.Pid)
+	}
+
+	for _, orphan := range orphans {
+		add(orphan)
+	}
+
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		for _, child := range children[pid] {
+			add(child)
+		}
+	}
+
+	self.Members = live
+	return nil
+}
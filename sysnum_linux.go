@@ -0,0 +1,7 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+package main
+
+// pidfd_open(2), the number is shared by the architectures that use the
+// generic syscall table
+const sysPidfdOpen = 434
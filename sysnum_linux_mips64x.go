@@ -0,0 +1,6 @@
+//go:build linux && (mips64 || mips64le)
+
+package main
+
+// pidfd_open(2), mips n64 numbers its syscalls from 5000
+const sysPidfdOpen = 5434
@@ -0,0 +1,6 @@
+//go:build linux && (mips || mipsle)
+
+package main
+
+// pidfd_open(2), mips o32 numbers its syscalls from 4000
+const sysPidfdOpen = 4434
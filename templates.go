@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateData is what --message, and the commands, urls and bodies of
+// notifications, are rendered with as go text/templates, eg:
+//
+//	--notify-by-running='notify-send {{shellquote .Target}} {{shellquote .Outcome}}'
+type TemplateData struct {
+	Kind        string
+	Target      string
+	Description string
+	Outcome     string
+	Error       string
+	Final       bool
+	Message     string
+	Start       time.Time
+	End         time.Time
+	Elapsed     time.Duration
+	ExitCode    string
+	Hostname    string
+	Details     map[string]string
+}
+
+func (self Event) TemplateData() TemplateData {
+	data := self.templateData()
+	data.Message = self.Message()
+	return data
+}
+
+// NB: the --message template is rendered with the default message, so
+// that it can't refer to itself
+func (self Event) templateData() TemplateData {
+	details := self.Details
+	if details == nil {
+		details = map[string]string{}
+	}
+
+	return TemplateData{
+		Kind:        self.WaitingOn.String(),
+		Target:      self.Target,
+		Description: self.Description,
+		Outcome:     self.Outcome,
+		Error:       self.Error,
+		Final:       self.Final(),
+		Message:     self.DefaultMessage(),
+		Start:       self.StartTime,
+		End:         self.EndTime,
+		Elapsed:     self.Elapsed().Round(time.Millisecond),
+		ExitCode:    details["exit_code"],
+		Hostname:    self.Hostname,
+		Details:     details,
+	}
+}
+
+// TemplateFuncs are available to every template.  NB: nothing is escaped
+// for you, values interpolated into a --notify-by-running command have to
+// go through shellquote (or be read from the TMW_* environment variables
+// instead), and values interpolated into a json body through json, eg:
+//
+//	--notify-by-running='notify-send {{shellquote .Message}}'
+//	--notify-url-body='{"text": {{json .Message}}}'
+var TemplateFuncs = template.FuncMap{
+	"shellquote": ShellQuote,
+	"json":       JsonQuote,
+}
+
+// ShellQuote single quotes value for bash, single quotes within it are
+// closed, escaped and reopened.
+func ShellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// JsonQuote renders value as a json value, strings are quoted and
+// escaped.
+func JsonQuote(value any) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=zero").Funcs(TemplateFuncs).Parse(text)
+}
+
+// RenderTemplate renders text with the event, text without any {{ }}
+// actions is returned as is.
+func RenderTemplate(name, text string, event Event) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := ParseTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+
+	var rendered strings.Builder
+	err = tmpl.Execute(&rendered, event.TemplateData())
+	if err != nil {
+		return "", err
+	}
+
+	return rendered.String(), nil
+}
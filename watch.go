@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrWatchUnsupported = errors.New("file watching is not supported on this platform")
+
+// while a FileWatch is delivering events polling is only a fallback
+var WatchedPollPolicy = PollPolicy{Interval: 5 * time.Second, MaxInterval: 5 * time.Second, BackoffFactor: 1.0}
+
+type WatchOp uint32
+
+const (
+	WatchCreated WatchOp = 1 << iota
+	WatchRemoved
+	WatchModified
+	// events were dropped, anything may have changed
+	WatchOverflow
+)
+
+type FileEvent struct {
+	Path  string
+	Op    WatchOp
+	IsDir bool
+}
+
+// Watchable conditions subscribe to a FileWatch so that WaitForCondition
+// is woken as soon as something changes instead of waiting out the poll
+// interval. The returned condition is used even when there is an error,
+// the error means it could not (fully) be watched and has to be polled.
+type Watchable interface {
+	Watch(*Context, *FileWatch) (Condition, error)
+}
+
+/******************************************************************************/
+// WatchQueue collects the events a FileWatch sees for one condition, each
+// condition drains its own queue so several conditions can share a watch.
+type WatchQueue struct {
+	mu      sync.Mutex
+	pending []FileEvent
+}
+
+func (self *WatchQueue) push(event FileEvent) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.pending = append(self.pending, event)
+}
+
+// Drain returns the events seen since the last call to Drain.
+func (self *WatchQueue) Drain() []FileEvent {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	events := self.pending
+	self.pending = nil
+	return events
+}
+
+// Saw reports whether any of events happened to path.
+func Saw(events []FileEvent, path string, op WatchOp) bool {
+	path = filepath.Clean(path)
+	for _, event := range events {
+		if event.Path == path && event.Op&op != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+/******************************************************************************/
+// WatchPaths adds each of paths to the watch and returns a queue of the
+// events seen from then on.
+func (self *FileWatch) WatchPaths(paths ...string) (*WatchQueue, error) {
+	for _, path := range paths {
+		err := self.Add(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return self.NewQueue(), nil
+}
+
+func (self *FileWatch) NewQueue() *WatchQueue {
+	queue := &WatchQueue{}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.queues = append(self.queues, queue)
+	return queue
+}
+
+// Events wakes whoever is waiting on it whenever new events arrive.
+func (self *FileWatch) Events() <-chan struct{} {
+	return self.wake
+}
+
+func (self *FileWatch) publish(event FileEvent) {
+	self.mu.Lock()
+	queues := self.queues
+	self.mu.Unlock()
+
+	for _, queue := range queues {
+		queue.push(event)
+	}
+
+	select {
+	case self.wake <- struct{}{}:
+	default:
+	}
+}
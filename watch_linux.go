@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyWatchMask = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_DELETE | syscall.IN_MOVED_FROM |
+	syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// FileWatch is backed by inotify on linux.
+type FileWatch struct {
+	fd     int
+	file   *os.File
+	wake   chan struct{}
+	mu     sync.Mutex
+	paths  map[int]string
+	queues []*WatchQueue
+}
+
+func NewFileWatch() (*FileWatch, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1: %w", err)
+	}
+
+	// NB: wrapping the non-blocking fd in an os.File lets the runtime poll
+	// it, which also means Close unblocks the pending Read. Don't call
+	// Fd() on it, that switches the fd back to blocking mode.
+	watch := &FileWatch{
+		fd:    fd,
+		file:  os.NewFile(uintptr(fd), "inotify"),
+		wake:  make(chan struct{}, 1),
+		paths: map[int]string{},
+	}
+
+	go watch.readEvents()
+	return watch, nil
+}
+
+// Add starts watching path, a file or a directory (and its entries).
+func (self *FileWatch) Add(path string) error {
+	path = filepath.Clean(path)
+	wd, err := syscall.InotifyAddWatch(self.fd, path, inotifyWatchMask)
+	if err != nil {
+		return fmt.Errorf("inotify_add_watch %s: %w", path, err)
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.paths[wd] = path
+	return nil
+}
+
+func (self *FileWatch) Close() error {
+	return self.file.Close()
+}
+
+func (self *FileWatch) readEvents() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := self.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buf[nameStart:nameStart+int(raw.Len)], "\x00"))
+			offset = nameStart + int(raw.Len)
+			self.dispatch(int(raw.Wd), raw.Mask, name)
+		}
+	}
+}
+
+func (self *FileWatch) dispatch(wd int, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		self.publish(FileEvent{Op: WatchOverflow})
+		return
+	}
+
+	self.mu.Lock()
+	path, ok := self.paths[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(self.paths, wd)
+	}
+	self.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if name != "" {
+		path = filepath.Join(path, name)
+	}
+
+	var op WatchOp
+	if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		op |= WatchCreated
+	}
+
+	if mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM|syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 {
+		op |= WatchRemoved
+	}
+
+	if mask&(syscall.IN_MODIFY|syscall.IN_ATTRIB|syscall.IN_CLOSE_WRITE) != 0 {
+		op |= WatchModified
+	}
+
+	if op == 0 {
+		return
+	}
+
+	self.publish(FileEvent{Path: path, Op: op, IsDir: mask&syscall.IN_ISDIR != 0})
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package main
+
+import "sync"
+
+// FileWatch is only implemented on linux, elsewhere every condition is
+// polled.
+type FileWatch struct {
+	wake   chan struct{}
+	mu     sync.Mutex
+	queues []*WatchQueue
+}
+
+func NewFileWatch() (*FileWatch, error) {
+	return nil, ErrWatchUnsupported
+}
+
+func (self *FileWatch) Add(path string) error {
+	return ErrWatchUnsupported
+}
+
+func (self *FileWatch) Close() error {
+	return nil
+}